@@ -0,0 +1,41 @@
+// Command rotate-keys replaces the access token signing key without waiting
+// for JWT_KEY_ROTATION. By default the new key is published first and only
+// signs once running servers and JWKS caches have picked it up, after
+// KEY_REFRESH_INTERVAL plus a minute, and the previous keys keep verifying
+// the tokens they signed until those expire. With -expire the new key signs
+// at once and the previous keys stop verifying.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	database "github.com/k1ender/task-master-go/internal/db"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+func main() {
+	expire := flag.Bool("expire", false, "expire the previous keys immediately, for a key that may have leaked")
+	flag.Parse()
+
+	cfg := config.MustInit(".env")
+	db := database.MustInit(cfg)
+
+	keys, err := auth.NewKeySet(storage.NewStorage(db), cfg.JWT, cfg.Scheduler.KeyRefreshInterval)
+	if err != nil {
+		panic(err)
+	}
+
+	rotate := keys.Rotate
+	if *expire {
+		rotate = keys.Replace
+	}
+	if err := rotate(context.Background()); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("signing key rotated")
+}
@@ -1,14 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/k1ender/task-master-go/internal/auth"
 	"github.com/k1ender/task-master-go/internal/config"
-	"github.com/k1ender/task-master-go/internal/db"
+	database "github.com/k1ender/task-master-go/internal/db"
+	"github.com/k1ender/task-master-go/internal/digest"
+	"github.com/k1ender/task-master-go/internal/events"
 	"github.com/k1ender/task-master-go/internal/logger"
 	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/ratelimit"
+	"github.com/k1ender/task-master-go/internal/reminders"
 	"github.com/k1ender/task-master-go/internal/routes"
+	"github.com/k1ender/task-master-go/internal/scheduler"
 	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/webhooks"
 )
 
 // @title Task Master API
@@ -17,18 +32,146 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cfg := config.MustInit(".env")
 
-	db := db.MustInit(cfg)
-	db.AutoMigrate(&models.User{}, &models.Task{})
+	db := database.MustInit(cfg)
+	// Task sync versions default to this sequence, so it has to exist before
+	// the columns are created.
+	db.Exec("CREATE SEQUENCE IF NOT EXISTS " + models.TaskSyncSequence)
+	db.AutoMigrate(
+		&models.User{},
+		&models.Task{},
+		&models.TaskTombstone{},
+		&models.TaskTemplate{},
+		&models.TaskTemplateItem{},
+		&models.Reminder{},
+		&models.Notification{},
+		&models.OutboxEmail{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.Event{},
+		&models.IdempotencyKey{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.PersonalAccessToken{},
+		&models.SigningKey{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorizationCode{},
+		&models.ExternalIdentity{},
+		&models.OIDCLoginState{},
+		&models.LoginFailure{},
+		&models.RateLimitBucket{},
+	)
 
 	storage := storage.NewStorage(db)
 
 	logger := logger.MustInit(cfg)
 
-	router := routes.New(db, cfg, storage, logger)
+	jobs := scheduler.New(logger)
+
+	var notifier notify.Notifier = notify.NewLogNotifier(logger)
+	if cfg.SMTP.Host != "" {
+		notifier = notify.Multi{notifier, notify.NewEmailNotifier(storage)}
+		outbox := notify.NewOutboxWorker(storage, notify.NewSMTPSender(cfg.SMTP), cfg.Scheduler.OutboxRetention, logger)
+		jobs.Add("outbox", cfg.Scheduler.OutboxInterval, outbox.Run)
+		jobs.Add("outbox_prune", time.Hour, outbox.Prune)
+	}
+
+	jobs.Add("reminders", cfg.Scheduler.ReminderInterval, reminders.NewDispatcher(storage, notifier, logger).Run)
+	jobs.Add("digests", cfg.Scheduler.DigestInterval, digest.NewJob(storage, notifier, cfg, logger).Run)
+	jobs.Add("webhooks", cfg.Scheduler.WebhookInterval, webhooks.NewDispatcher(storage, logger).Run)
+	jobs.Add("webhook_deliveries", time.Hour, func(ctx context.Context) error {
+		return storage.Webhooks.PruneDeliveries(time.Now().Add(-cfg.Scheduler.WebhookRetention))
+	})
+	jobs.Add("events", time.Hour, func(ctx context.Context) error {
+		return storage.Events.PruneEvents(time.Now().Add(-cfg.Scheduler.EventRetention))
+	})
+	jobs.Add("idempotency", time.Hour, func(ctx context.Context) error {
+		return storage.Idempotency.PruneKeys(time.Now())
+	})
+	jobs.Add("refresh_tokens", time.Hour, func(ctx context.Context) error {
+		return storage.RefreshTokens.PruneRefreshTokens(time.Now())
+	})
+	denylist := auth.NewDenylist(storage)
+	if err := denylist.Refresh(ctx); err != nil {
+		panic(err)
+	}
+	jobs.Add("denylist", cfg.Scheduler.DenylistInterval, denylist.Refresh)
+	keys, err := auth.NewKeySet(storage, cfg.JWT, cfg.Scheduler.KeyRefreshInterval)
+	if err != nil {
+		panic(err)
+	}
+	if err := keys.Refresh(ctx); err != nil {
+		panic(err)
+	}
+	passwords, err := auth.NewPasswords(cfg.Password)
+	if err != nil {
+		panic(err)
+	}
+	jobs.Add("signing_keys", cfg.Scheduler.KeyRefreshInterval, keys.Refresh)
+	jobs.Add("expired_signing_keys", time.Hour, func(ctx context.Context) error {
+		return storage.SigningKeys.PruneSigningKeys(time.Now())
+	})
+	jobs.Add("oauth_codes", time.Hour, func(ctx context.Context) error {
+		return storage.OAuth.PruneAuthorizationCodes(time.Now())
+	})
+	jobs.Add("oidc_logins", time.Hour, func(ctx context.Context) error {
+		return storage.OIDC.PruneLoginStates(time.Now())
+	})
+	jobs.Add("login_failures", time.Hour, func(ctx context.Context) error {
+		return storage.LoginFailures.PruneLoginFailures(time.Now().Add(-cfg.Auth.LoginLockout))
+	})
+	jobs.Add("revoked_tokens", time.Hour, func(ctx context.Context) error {
+		return storage.RevokedTokens.PruneRevokedTokens(time.Now())
+	})
+	jobs.Add("sessions", time.Hour, func(ctx context.Context) error {
+		return storage.Sessions.PruneSessions(time.Now().Add(-cfg.JWT.RefreshTokenTTL))
+	})
+	jobs.Add("password_resets", time.Hour, func(ctx context.Context) error {
+		return storage.PasswordReset.PrunePasswordResetTokens(time.Now())
+	})
+	var limiter ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case config.RateLimitStoreMemory:
+		limiter = ratelimit.NewMemoryStore()
+	case config.RateLimitStorePostgres:
+		limiter = ratelimit.NewPostgresStore(storage)
+	default:
+		panic("unknown rate limit store " + cfg.RateLimit.Store)
+	}
+	jobs.Add("rate_limits", time.Minute, limiter.Prune)
+	jobs.Start(ctx)
+
+	broker := events.NewBroker(database.DSN(cfg), storage, logger)
+	go broker.Run(ctx)
+
+	router := routes.New(db, cfg, storage, broker, denylist, keys, passwords, limiter, notifier, logger)
+
+	server := &http.Server{
+		Addr:    ":" + cfg.HttpServer.Port,
+		Handler: router,
+		// Cancel long-lived requests such as event streams on shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 
 	logger.Info("Server started", "port", cfg.HttpServer.Port)
 
-	http.ListenAndServe(":"+cfg.HttpServer.Port, router)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Server failed", "error", err)
+	}
+
+	jobs.Wait()
 }
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxBreachedLine is the longest line expected in a hash list: a hash,
+	// a count and a line break.
+	maxBreachedLine = 128
+	// breachedSortCheckLines is how many lines at the start of a hash list
+	// are checked to be in order when it is opened.
+	breachedSortCheckLines = 1000
+	// maxBreachedPasswordsSize is the largest list of plain passwords that
+	// is loaded into memory. Larger lists have to be hash lists.
+	maxBreachedPasswordsSize = 64 << 20
+)
+
+var errBreachedListTooLarge = errors.New("plain password list is larger than 64 MiB, use a SHA-1 list ordered by hash")
+
+// breachedHashFile is a list of upper-case hex SHA-1 hashes, one per line
+// and optionally followed by ":count", ordered by hash, such as the Have I
+// Been Pwned download. It is binary searched on disk, so lists of any size
+// need no memory.
+type breachedHashFile struct {
+	f    *os.File
+	size int64
+}
+
+// openBreachedList opens the list at path. A list of hashes is searched on
+// disk; any other list is read as plain passwords into breached.
+func openBreachedList(path string, breached map[string]struct{}) (*breachedHashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	first, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+
+	if hash, ok := parseHashLine(first); ok && hash != "" {
+		list := &breachedHashFile{f: f, size: info.Size()}
+		if err := list.checkOrder(); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return list, nil
+	}
+	defer f.Close()
+
+	if info.Size() > maxBreachedPasswordsSize {
+		return nil, errBreachedListTooLarge
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return nil, readBreached(f, breached)
+}
+
+// checkOrder checks the first lines of the list, to catch lists that are
+// ordered by count instead of by hash.
+func (l *breachedHashFile) checkOrder() error {
+	scanner := bufio.NewScanner(io.NewSectionReader(l.f, 0, l.size))
+	var previous string
+	for i := 0; i < breachedSortCheckLines && scanner.Scan(); i++ {
+		hash, ok := parseHashLine(scanner.Text())
+		if !ok {
+			return fmt.Errorf("line %d is not a SHA-1 hash", i+1)
+		}
+		if hash < previous {
+			return errors.New("hashes are not ordered by hash")
+		}
+		previous = hash
+	}
+	return scanner.Err()
+}
+
+// Contains reports whether the list has hash, an upper-case hex SHA-1.
+func (l *breachedHashFile) Contains(hash string) (bool, error) {
+	var readErr error
+	// The smallest offset whose next line has a hash not below the one
+	// looked for: the line with the hash, if there is one.
+	offset := sort.Search(int(l.size)+1, func(i int) bool {
+		if readErr != nil {
+			return true
+		}
+
+		lineHash, err := l.hashAt(int64(i))
+		if err != nil {
+			readErr = err
+			return true
+		}
+		return lineHash == "" || lineHash >= hash
+	})
+	if readErr != nil {
+		return false, readErr
+	}
+
+	found, err := l.hashAt(int64(offset))
+	return found == hash, err
+}
+
+// hashAt returns the hash of the first line that starts at or after
+// offset, or "" if there is none.
+func (l *breachedHashFile) hashAt(offset int64) (string, error) {
+	start := max(offset-1, 0)
+	buf := make([]byte, maxBreachedLine)
+	n, err := l.f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+
+	// A line starts at offset if the byte before it ends the previous one.
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return "", nil
+		}
+		buf = buf[i+1:]
+	}
+
+	line, _, _ := bytes.Cut(buf, []byte{'\n'})
+	hash, _ := parseHashLine(string(line))
+	return hash, nil
+}
+
+// parseHashLine returns the upper-case hash of a "HASH" or "HASH:COUNT"
+// line. Empty lines give an empty hash.
+func parseHashLine(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", true
+	}
+
+	hash, count, _ := strings.Cut(line, ":")
+	if !isSHA1(hash) || (count != "" && !isNumber(count)) {
+		return "", false
+	}
+	return strings.ToUpper(hash), true
+}
+
+// readBreached reads plain passwords, one per line, into breached. Lines
+// that are a SHA-1 in hex are taken as the hash of the password.
+func readBreached(r io.Reader, breached map[string]struct{}) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if hash, ok := parseHashLine(line); ok {
+			breached[hash] = struct{}{}
+			continue
+		}
+
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
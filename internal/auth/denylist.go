@@ -0,0 +1,127 @@
+// Package auth holds server-side state about issued credentials.
+package auth
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	denylistBatch = 1000
+	// denylistOverlap is how far back each refresh reads again. Revocations
+	// are stamped before they commit, possibly by an instance whose clock
+	// is behind, so one can commit after a later-stamped one has already
+	// been read.
+	denylistOverlap = time.Minute
+)
+
+// Denylist answers whether an access token has been revoked without a
+// database round trip. Revocations are written to the database and kept in
+// memory; Refresh picks up revocations made by other instances, so they
+// take effect there within one refresh interval.
+type Denylist struct {
+	store *storage.Storage
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	// seenUntil is the latest creation time of the revocations read.
+	seenUntil time.Time
+}
+
+func NewDenylist(store *storage.Storage) *Denylist {
+	return &Denylist{
+		store:   store,
+		revoked: map[string]time.Time{},
+	}
+}
+
+// Revoke denies the token with jti until expiresAt.
+func (d *Denylist) Revoke(jti string, expiresAt time.Time) error {
+	if err := d.store.RevokedTokens.RevokeToken(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.revoked[jti] = expiresAt
+	d.mu.Unlock()
+
+	return nil
+}
+
+// RevokeSession denies every token issued for the session until expiresAt,
+// which should be when the last of them expires.
+func (d *Denylist) RevokeSession(sessionID uint, expiresAt time.Time) error {
+	return d.Revoke(sessionKey(sessionID), expiresAt)
+}
+
+func (d *Denylist) IsSessionRevoked(sessionID uint) bool {
+	return sessionID != 0 && d.IsRevoked(sessionKey(sessionID))
+}
+
+func sessionKey(sessionID uint) string {
+	return "sid:" + strconv.FormatUint(uint64(sessionID), 10)
+}
+
+func (d *Denylist) IsRevoked(jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.revoked[jti]
+	return ok
+}
+
+// Refresh loads revocations recorded since the last call, reading the last
+// denylistOverlap again, and forgets those for tokens that have expired. It
+// has the signature of a scheduler job.
+func (d *Denylist) Refresh(ctx context.Context) error {
+	d.mu.RLock()
+	var since time.Time
+	if !d.seenUntil.IsZero() {
+		since = d.seenUntil.Add(-denylistOverlap)
+	}
+	d.mu.RUnlock()
+
+	var afterID uint
+	for {
+		tokens, err := d.store.RevokedTokens.GetRevokedTokensSince(since, afterID, denylistBatch)
+		if err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		for _, token := range tokens {
+			d.revoked[token.JTI] = token.ExpiresAt
+			if token.CreatedAt.After(d.seenUntil) {
+				d.seenUntil = token.CreatedAt
+			}
+		}
+		d.mu.Unlock()
+
+		if len(tokens) < denylistBatch {
+			break
+		}
+		last := tokens[len(tokens)-1]
+		since, afterID = last.CreatedAt, last.ID
+	}
+
+	now := time.Now()
+
+	d.mu.Lock()
+	for jti, expiresAt := range d.revoked {
+		if now.After(expiresAt) {
+			delete(d.revoked, jti)
+		}
+	}
+	d.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+// Access token signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits = 2048
+	// reloadInterval limits how often an unknown kid triggers a reload, so
+	// that forged kids cannot be used to hammer the database.
+	reloadInterval = time.Second
+	// JWKSMaxAge is how long verifiers may cache the JWKS.
+	JWKSMaxAge = time.Minute
+)
+
+var errUnknownKey = errors.New("token signed with an unknown key")
+
+// KeySet signs and verifies access tokens. With HS256 it uses the shared
+// JWT secret. With RS256 or EdDSA it uses keys stored in the database, so
+// that every instance signs with the same key and verifies the tokens of
+// the others: the newest key signs, and retired keys verify the tokens they
+// signed until those expire. A rotated key is published for publishDelay
+// before it signs, so that verifiers caching the JWKS know it by then.
+type KeySet struct {
+	store     *storage.Storage
+	algorithm string
+	secret    []byte
+	rotation  time.Duration
+	// tokenTTL is how long a retired key must keep verifying.
+	tokenTTL time.Duration
+	// publishDelay is how long a new key takes to reach the JWKS of every
+	// instance and the caches of verifiers.
+	publishDelay time.Duration
+
+	mu      sync.RWMutex
+	current *signingKey
+	// next is a rotated key that is published but does not sign yet.
+	next     *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}
+
+type signingKey struct {
+	kid       string
+	algorithm string
+	private   crypto.Signer
+	activeAt  time.Time
+}
+
+// NewKeySet creates a key set for cfg. refreshInterval is how often
+// instances reload the keys, and so how long a new key can take to show
+// up in all their JWKS.
+func NewKeySet(store *storage.Storage, cfg config.JWT, refreshInterval time.Duration) (*KeySet, error) {
+	switch cfg.Algorithm {
+	case AlgHS256, AlgRS256, AlgEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	return &KeySet{
+		store:     store,
+		algorithm: cfg.Algorithm,
+		secret:    []byte(cfg.Secret),
+		rotation:  cfg.KeyRotation,
+		tokenTTL:  cfg.AccessTokenTTL,
+		// Before the new key signs, every instance must have reloaded it
+		// and verifiers must have dropped the JWKS they cached before.
+		publishDelay: refreshInterval + JWKSMaxAge,
+		keys:         map[string]*signingKey{},
+	}, nil
+}
+
+// Refresh reloads the keys and rotates the signing key when it is missing
+// or older than the rotation period. It is meant to be called periodically
+// by the scheduler.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	if k.algorithm == AlgHS256 {
+		return nil
+	}
+
+	if err := k.load(); err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	latest := k.current
+	if k.next != nil {
+		latest = k.next
+	}
+	k.mu.RUnlock()
+
+	if latest == nil || (k.rotation > 0 && time.Since(latest.activeAt) >= k.rotation) {
+		return k.Rotate(ctx)
+	}
+
+	return nil
+}
+
+// Rotate generates a new signing key and retires the previous ones. The
+// new key is published right away but only signs after publishDelay, and
+// until then the current key keeps signing. Tokens the previous keys
+// signed stay valid until they expire.
+func (k *KeySet) Rotate(ctx context.Context) error {
+	return k.rotate(true)
+}
+
+// Replace generates a new signing key that signs at once and expires the
+// previous ones, for when a key may have leaked. Tokens they signed stop
+// working, and clients have to get new ones with their refresh tokens.
+// Verifiers reject tokens of the new key until they reload the JWKS.
+func (k *KeySet) Replace(ctx context.Context) error {
+	return k.rotate(false)
+}
+
+func (k *KeySet) rotate(graceful bool) error {
+	if k.algorithm == AlgHS256 {
+		return errors.New("HS256 uses JWT_SECRET and has no keys to rotate")
+	}
+
+	if err := k.load(); err != nil {
+		return err
+	}
+
+	key, err := generateSigningKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key.ActiveAt = now
+	expiresAt := now
+	if graceful {
+		k.mu.RLock()
+		signing := k.current != nil
+		k.mu.RUnlock()
+
+		// The first key has no verifiers to wait for.
+		if signing {
+			key.ActiveAt = now.Add(k.publishDelay)
+		}
+		expiresAt = key.ActiveAt.Add(k.tokenTTL)
+	}
+
+	err = k.store.Transaction(func(tx *storage.Storage) error {
+		if err := tx.SigningKeys.CreateSigningKey(key); err != nil {
+			return err
+		}
+
+		return tx.SigningKeys.RetireSigningKeys(key.ID, expiresAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	return k.load()
+}
+
+func (k *KeySet) load() error {
+	rows, err := k.store.SigningKeys.GetSigningKeys(time.Now())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var current, next *signingKey
+	keys := make(map[string]*signingKey, len(rows))
+	for _, row := range rows {
+		key, err := parseSigningKey(row)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.KID, err)
+		}
+
+		keys[key.kid] = key
+		// Keys of another algorithm, left from before JWT_ALGORITHM was
+		// changed, only verify.
+		if row.Algorithm != k.algorithm {
+			continue
+		}
+
+		switch {
+		case row.ActiveAt.After(now):
+			if next == nil && row.ExpiresAt == nil {
+				next = key
+			}
+		// A retired key signs while its successor is being published, as
+		// long as the tokens it signs expire before it does.
+		case current == nil && (row.ExpiresAt == nil || !row.ExpiresAt.Before(now.Add(k.tokenTTL))):
+			current = key
+		}
+	}
+
+	k.mu.Lock()
+	k.current = current
+	k.next = next
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
+
+// Sign signs claims with the current key.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if k.algorithm == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	k.mu.RLock()
+	current := k.current
+	// The next key takes over on time even if it was loaded before.
+	if k.next != nil && !time.Now().Before(k.next.activeAt) {
+		current = k.next
+	}
+	k.mu.RUnlock()
+
+	if current == nil {
+		return "", errors.New("no signing key is available")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(current.algorithm), claims)
+	token.Header["kid"] = current.kid
+	return token.SignedString(current.private)
+}
+
+// Keyfunc returns the key that verifies token, for jwt.Parse.
+func (k *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	if k.algorithm == AlgHS256 {
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key := k.lookup(kid)
+	if key == nil {
+		// The key may have just been created by another instance.
+		k.mu.RLock()
+		stale := time.Since(k.loadedAt) > reloadInterval
+		k.mu.RUnlock()
+		if stale {
+			if err := k.load(); err != nil {
+				return nil, err
+			}
+			key = k.lookup(kid)
+		}
+	}
+
+	if key == nil {
+		return nil, errUnknownKey
+	}
+
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("key %s is for %s, not %s", kid, key.algorithm, token.Method.Alg())
+	}
+
+	return key.private.Public(), nil
+}
+
+// Algorithms returns the algorithms tokens may be signed with.
+func (k *KeySet) Algorithms() []string {
+	if k.algorithm == AlgHS256 {
+		return []string{AlgHS256}
+	}
+	return []string{AlgRS256, AlgEdDSA}
+}
+
+func (k *KeySet) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys (RFC 8037).
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that verify access tokens. It is empty with
+// HS256, whose secret cannot be published.
+func (k *KeySet) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.Kid, b.Kid) })
+
+	return set
+}
+
+func generateSigningKey(algorithm string) (*models.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("cannot generate keys for %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := utils.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parseSigningKey(row models.SigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return &signingKey{
+		kid:       row.KID,
+		algorithm: row.Algorithm,
+		private:   private,
+		activeAt:  row.ActiveAt,
+	}, nil
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ErrPasswordMismatch is returned by Verify when the password is wrong.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHasher hashes passwords with one algorithm.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch if password does not match hash.
+	Verify(hash, password string) error
+	// Owns reports whether hash was made with this hasher's algorithm.
+	Owns(hash string) bool
+	// Outdated reports whether hash, made with this hasher's algorithm,
+	// used other parameters than new hashes do.
+	Outdated(hash string) bool
+}
+
+// Argon2idHasher hashes with Argon2id (RFC 9106). Hashes are stored in the
+// PHC string format, "$argon2id$v=19$m=...,t=...,p=...$salt$key", so the
+// parameters of each hash are known when verifying it. Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) error {
+	parsed, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Outdated(hash string) bool {
+	parsed, err := parseArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+
+	return parsed.memory != h.Memory ||
+		parsed.iterations != h.Iterations ||
+		parsed.parallelism != h.Parallelism ||
+		len(parsed.key) != argon2KeyLength
+}
+
+func parseArgon2Hash(hash string) (*argon2Hash, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("argon2id hash: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("argon2id hash: unsupported version %d", version)
+	}
+
+	var parsed argon2Hash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.iterations, &parsed.parallelism); err != nil {
+		return nil, fmt.Errorf("argon2id hash: %w", err)
+	}
+	// argon2.IDKey panics on these.
+	if parsed.iterations < 1 || parsed.parallelism < 1 {
+		return nil, errors.New("argon2id hash: invalid parameters")
+	}
+
+	var err error
+	if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("argon2id hash: %w", err)
+	}
+	if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("argon2id hash: %w", err)
+	}
+	if len(parsed.key) == 0 {
+		return nil, errors.New("argon2id hash: empty key")
+	}
+
+	return &parsed, nil
+}
+
+// BcryptHasher hashes with bcrypt, which only looks at the first 72 bytes
+// of a password.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Passwords hashes new passwords with the configured algorithm and checks
+// them against the password policy. It verifies hashes made with any
+// supported algorithm, and tells when one should be replaced.
+type Passwords struct {
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+	policy    *PasswordPolicy
+	// dummyHash is verified against for users that do not exist, so they
+	// take as long to reject as the ones that do.
+	dummyHash string
+}
+
+func NewPasswords(cfg config.Password) (*Passwords, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	argon2id := &Argon2idHasher{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	}
+	bcryptHasher := &BcryptHasher{Cost: cfg.BcryptCost}
+
+	p := &Passwords{hashers: []PasswordHasher{argon2id, bcryptHasher}}
+	switch cfg.Hash {
+	case PasswordHashArgon2id:
+		p.preferred = argon2id
+	case PasswordHashBcrypt:
+		p.preferred = bcryptHasher
+	default:
+		return nil, fmt.Errorf("unknown password hash %q", cfg.Hash)
+	}
+
+	policy, err := NewPasswordPolicy(cfg, cfg.Hash == PasswordHashBcrypt)
+	if err != nil {
+		return nil, err
+	}
+	p.policy = policy
+
+	if p.dummyHash, err = p.preferred.Hash("dummy password"); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Hash hashes password with the configured algorithm.
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+// Verify returns ErrPasswordMismatch if password does not match hash. When
+// it matches, rehash reports whether hash should be replaced by a new one,
+// because it was made with another algorithm or older parameters.
+func (p *Passwords) Verify(hash, password string) (rehash bool, err error) {
+	for _, hasher := range p.hashers {
+		if !hasher.Owns(hash) {
+			continue
+		}
+
+		if err := hasher.Verify(hash, password); err != nil {
+			return false, err
+		}
+
+		return hasher != p.preferred || hasher.Outdated(hash), nil
+	}
+
+	return false, errors.New("unknown password hash format")
+}
+
+// VerifyDummy spends as long as Verify on a hash of the configured
+// algorithm, and always fails.
+func (p *Passwords) VerifyDummy(password string) {
+	p.preferred.Verify(p.dummyHash, password)
+}
+
+// Check returns a *PasswordPolicyError if password may not be used by the
+// user with username.
+func (p *Passwords) Check(password, username string) error {
+	return p.policy.Check(password, username)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/k1ender/task-master-go/internal/config"
+)
+
+const (
+	// bcryptMaxLength is how many bytes of a password bcrypt uses.
+	bcryptMaxLength = 72
+	// minUsernameLength is the shortest username passwords are checked
+	// against; shorter ones would rule out too many passwords.
+	minUsernameLength = 3
+)
+
+// commonPasswords are refused even without a breached password list.
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicyError explains why a password may not be used. Its message
+// is meant for the user.
+type PasswordPolicyError struct {
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// PasswordPolicy decides which new passwords are accepted: long enough, not
+// too long, not the username, and not known from breaches.
+type PasswordPolicy struct {
+	minLength int
+	maxLength int
+	// maxBytes is set when the hash only uses that many bytes.
+	maxBytes int
+	// breached holds the upper-case hex SHA-1 of refused passwords from
+	// the built-in list and from a plain password list.
+	breached map[string]struct{}
+	// breachedFile is a hash list too large to hold in memory.
+	breachedFile *breachedHashFile
+}
+
+// NewPasswordPolicy builds the policy of cfg, reading its breached password
+// list. bcrypt limits the length of passwords to what bcrypt can hash.
+func NewPasswordPolicy(cfg config.Password, bcrypt bool) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength: cfg.MinLength,
+		maxLength: cfg.MaxLength,
+		breached:  map[string]struct{}{},
+	}
+	if bcrypt {
+		policy.maxBytes = bcryptMaxLength
+	}
+
+	if err := readBreached(strings.NewReader(commonPasswords), policy.breached); err != nil {
+		return nil, err
+	}
+
+	if cfg.BreachedList != "" {
+		file, err := openBreachedList(cfg.BreachedList, policy.breached)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.BreachedList, err)
+		}
+		policy.breachedFile = file
+	}
+
+	return policy, nil
+}
+
+// Check returns a *PasswordPolicyError if password may not be used by the
+// user with username. Other errors mean the breached password list could
+// not be read.
+func (p *PasswordPolicy) Check(password, username string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return &PasswordPolicyError{Message: fmt.Sprintf("Password must be at least %d characters long", p.minLength)}
+	}
+
+	if p.maxLength > 0 && length > p.maxLength {
+		return &PasswordPolicyError{Message: fmt.Sprintf("Password must be at most %d characters long", p.maxLength)}
+	}
+
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		return &PasswordPolicyError{Message: fmt.Sprintf("Password must be at most %d bytes long", p.maxBytes)}
+	}
+
+	if utf8.RuneCountInString(username) >= minUsernameLength && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &PasswordPolicyError{Message: "Password must not contain the username"}
+	}
+
+	hash := sha1Hex(password)
+	breached := false
+	if _, ok := p.breached[hash]; ok {
+		breached = true
+	} else if p.breachedFile != nil {
+		found, err := p.breachedFile.Contains(hash)
+		if err != nil {
+			return err
+		}
+		breached = found
+	}
+
+	if breached {
+		return &PasswordPolicyError{Message: "Password is too common or has appeared in a data breach"}
+	}
+
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import "slices"
+
+// Scopes limit what a personal access token can do. Tokens from a login
+// carry no scopes and are not limited.
+const (
+	ScopeTasksRead          = "tasks:read"
+	ScopeTasksWrite         = "tasks:write"
+	ScopeTemplatesRead      = "templates:read"
+	ScopeTemplatesWrite     = "templates:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+	ScopeWebhooksAdmin      = "webhooks:admin"
+	ScopeUserRead           = "user:read"
+	ScopeUserWrite          = "user:write"
+)
+
+var scopes = []string{
+	ScopeTasksRead,
+	ScopeTasksWrite,
+	ScopeTemplatesRead,
+	ScopeTemplatesWrite,
+	ScopeNotificationsRead,
+	ScopeNotificationsWrite,
+	ScopeWebhooksAdmin,
+	ScopeUserRead,
+	ScopeUserWrite,
+}
+
+// IsScope reports whether scope is a known scope.
+func IsScope(scope string) bool {
+	return slices.Contains(scopes, scope)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the key of the RFC 4226 and RFC 6238 (SHA1) test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, Appendix D.
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter), 6); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238, Appendix B, SHA1 rows.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	key, err := decodeTOTPSecret(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		if got := hotp(key, uint64(TOTPCounter(at)), 8); got != tt.code {
+			t.Errorf("8-digit code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+
+		// Six digits are the last six of the eight.
+		got, err := TOTP(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.code[2:]; got != want {
+			t.Errorf("TOTP at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := TOTPCounter(now)
+
+	codeAt := func(steps int64) string {
+		code, err := TOTP(rfcSecret, now.Add(time.Duration(steps*totpPeriod)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name        string
+		code        string
+		lastCounter int64
+		wantCounter int64
+		wantOK      bool
+	}{
+		{"current step", codeAt(0), 0, current, true},
+		{"one step behind", codeAt(-1), 0, current - 1, true},
+		{"one step ahead", codeAt(1), 0, current + 1, true},
+		{"two steps behind", codeAt(-2), 0, 0, false},
+		{"two steps ahead", codeAt(2), 0, 0, false},
+		{"reused step", codeAt(0), current, 0, false},
+		{"step before the last used", codeAt(-1), current, 0, false},
+		{"step after the last used", codeAt(1), current, current + 1, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"too short", codeAt(0)[:5], 0, 0, false},
+		{"too long", codeAt(0) + "0", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := ValidateTOTP(rfcSecret, tt.code, tt.lastCounter, now)
+			if ok != tt.wantOK || counter != tt.wantCounter {
+				t.Errorf("ValidateTOTP = (%d, %t), want (%d, %t)", counter, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInvalidSecret(t *testing.T) {
+	if _, ok := ValidateTOTP("not base32!", "123456", 0, time.Now()); ok {
+		t.Error("ValidateTOTP accepted a code for an invalid secret")
+	}
+}
@@ -1,16 +1,37 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
 
 type Config struct {
-	ENV        string `env:"ENV" env-required:"true"`
-	HttpServer HttpServer
-	Database   Database
-	JWT        JWT
+	ENV         string `env:"ENV" env-required:"true"`
+	HttpServer  HttpServer
+	Database    Database
+	JWT         JWT
+	Auth        Auth
+	Password    Password
+	Scheduler   Scheduler
+	SMTP        SMTP
+	Idempotency Idempotency
+	OIDC        OIDC
+	RateLimit   RateLimit
 }
 
 type HttpServer struct {
 	Port string `env:"PORT" env-default:"8080"`
+	// PublicURL is the externally reachable base URL used in links sent to users.
+	PublicURL string `env:"PUBLIC_URL" env-default:"http://localhost:8080"`
+	// AllowedOrigins lists the origins, such as "https://app.example.com",
+	// of web apps that may open WebSockets besides PUBLIC_URL.
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS" env-separator:","`
+	// RequireIfMatch rejects task updates and deletes without an If-Match
+	// header with 428 Precondition Required.
+	RequireIfMatch bool `env:"REQUIRE_IF_MATCH" env-default:"false"`
 }
 
 type Database struct {
@@ -23,8 +44,159 @@ type Database struct {
 
 type JWT struct {
 	Secret string `env:"JWT_SECRET" env-required:"true"`
+	// Algorithm signs access tokens: "HS256" with Secret, or "RS256" or
+	// "EdDSA" with keys generated and stored in the database, whose public
+	// halves are published at /.well-known/jwks.json.
+	Algorithm string `env:"JWT_ALGORITHM" env-default:"HS256"`
+	// KeyRotation is how long an asymmetric signing key is used before a new
+	// one replaces it. Zero disables automatic rotation.
+	KeyRotation time.Duration `env:"JWT_KEY_ROTATION" env-default:"720h"`
+	// AccessTokenTTL is the lifetime of access tokens. Clients renew them
+	// with a refresh token, which lives for RefreshTokenTTL after its last
+	// use.
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+}
+
+type Auth struct {
+	// PasswordResetTTL is how long a password reset link stays valid.
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" env-default:"1h"`
+	// EmailVerificationTTL is how long an email verification link stays
+	// valid.
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" env-default:"48h"`
+	// RequireVerifiedEmail blocks webhooks and digest emails for users
+	// without a verified email address.
+	RequireVerifiedEmail bool `env:"REQUIRE_VERIFIED_EMAIL" env-default:"false"`
+	// MFAChallengeTTL is how long a user with two-factor authentication has
+	// to enter a code after their password was accepted.
+	MFAChallengeTTL time.Duration `env:"MFA_CHALLENGE_TTL" env-default:"5m"`
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `env:"TOTP_ISSUER" env-default:"Task Master"`
+	// LoginMaxFailures is how many failed logins lock an account for
+	// LoginLockout, and LoginIPMaxFailures how many lock out the address
+	// they came from. Failures before that slow further attempts down.
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" env-default:"5"`
+	LoginIPMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES" env-default:"50"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" env-default:"15m"`
+}
+
+type Password struct {
+	// Hash is the algorithm of new password hashes, "argon2id" or
+	// "bcrypt". Hashes made with the other one, or with other parameters,
+	// are replaced when the user next logs in.
+	Hash string `env:"PASSWORD_HASH" env-default:"argon2id"`
+	// Argon2Memory is in KiB. The defaults follow the OWASP recommendation.
+	Argon2Memory      uint32 `env:"ARGON2_MEMORY" env-default:"19456"`
+	Argon2Iterations  uint32 `env:"ARGON2_ITERATIONS" env-default:"2"`
+	Argon2Parallelism uint8  `env:"ARGON2_PARALLELISM" env-default:"1"`
+	BcryptCost        int    `env:"BCRYPT_COST" env-default:"10"`
+	MinLength         int    `env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	MaxLength         int    `env:"PASSWORD_MAX_LENGTH" env-default:"128"`
+	// BreachedList is a file of passwords that may not be used, in addition
+	// to a built-in list of common ones. It is either the Have I Been Pwned
+	// SHA-1 list ordered by hash, "HASH:COUNT" per line, which is searched
+	// on disk and may be of any size, or up to 64 MiB of plain passwords,
+	// one per line, which are loaded into memory.
+	BreachedList string `env:"PASSWORD_BREACHED_LIST"`
+}
+
+// Validate rejects settings that would make hashing fail or panic.
+func (p Password) Validate() error {
+	switch {
+	case p.Argon2Iterations < 1:
+		return errors.New("ARGON2_ITERATIONS must be at least 1")
+	case p.Argon2Parallelism < 1:
+		return errors.New("ARGON2_PARALLELISM must be at least 1")
+	case p.Argon2Memory < 8*uint32(p.Argon2Parallelism):
+		return fmt.Errorf("ARGON2_MEMORY must be at least %d, 8 KiB per thread", 8*uint32(p.Argon2Parallelism))
+	case p.BcryptCost < 4 || p.BcryptCost > 31:
+		return errors.New("BCRYPT_COST must be between 4 and 31")
+	case p.MinLength < 1:
+		return errors.New("PASSWORD_MIN_LENGTH must be at least 1")
+	case p.MaxLength != 0 && p.MaxLength < p.MinLength:
+		return errors.New("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+	return nil
+}
+
+type Scheduler struct {
+	ReminderInterval time.Duration `env:"REMINDER_INTERVAL" env-default:"30s"`
+	OutboxInterval   time.Duration `env:"OUTBOX_INTERVAL" env-default:"15s"`
+	DigestInterval   time.Duration `env:"DIGEST_INTERVAL" env-default:"1m"`
+	WebhookInterval  time.Duration `env:"WEBHOOK_INTERVAL" env-default:"5s"`
+	// OutboxRetention is how long sent and undeliverable emails stay in
+	// the outbox.
+	OutboxRetention time.Duration `env:"OUTBOX_RETENTION" env-default:"24h"`
+	// EventRetention is how long change events stay available for
+	// clients resuming an event stream.
+	EventRetention time.Duration `env:"EVENT_RETENTION" env-default:"24h"`
+	// WebhookRetention is how long finished webhook deliveries stay in the
+	// delivery log.
+	WebhookRetention time.Duration `env:"WEBHOOK_RETENTION" env-default:"720h"`
+	// DenylistInterval is how often revoked access tokens are reloaded, and
+	// so how long a logout on one instance can take to reach the others.
+	DenylistInterval time.Duration `env:"DENYLIST_INTERVAL" env-default:"5s"`
+	// KeyRefreshInterval is how often signing keys are reloaded and rotated
+	// when due.
+	KeyRefreshInterval time.Duration `env:"KEY_REFRESH_INTERVAL" env-default:"1m"`
+}
+
+type Idempotency struct {
+	// TTL is how long responses to requests with an Idempotency-Key are
+	// kept for replay.
+	TTL time.Duration `env:"IDEMPOTENCY_TTL" env-default:"24h"`
+}
+
+type RateLimit struct {
+	// Store keeps the buckets in "memory", separately on each instance, or
+	// in "postgres", shared by all instances.
+	Store string `env:"RATE_LIMIT_STORE" env-default:"memory"`
+	// Limits are "requests/period": a client may make requests at once and
+	// regains them evenly over period. An empty limit disables the group.
+	// Auth covers login, registration, password reset and the OAuth
+	// endpoints, per client IP; API covers authenticated routes, per user.
+	Auth string `env:"RATE_LIMIT_AUTH" env-default:"20/1m"`
+	API  string `env:"RATE_LIMIT_API" env-default:"600/1m"`
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// OIDC login is disabled when Issuer is empty.
+type OIDC struct {
+	// Issuer is the provider's issuer URL. Its discovery document is read
+	// from Issuer + "/.well-known/openid-configuration".
+	Issuer       string `env:"OIDC_ISSUER"`
+	ClientID     string `env:"OIDC_CLIENT_ID"`
+	ClientSecret string `env:"OIDC_CLIENT_SECRET"`
+	// RedirectURL must be registered with the provider. It defaults to
+	// PublicURL + "/login/oidc/callback".
+	RedirectURL string `env:"OIDC_REDIRECT_URL"`
+	Scopes      string `env:"OIDC_SCOPES" env-default:"openid email profile"`
+	// AutoProvision creates a user on the first login of an identity that
+	// is not linked to an existing one.
+	AutoProvision bool `env:"OIDC_AUTO_PROVISION" env-default:"true"`
+}
+
+// SMTP delivery is disabled when Host is empty.
+type SMTP struct {
+	Host     string `env:"SMTP_HOST"`
+	Port     string `env:"SMTP_PORT" env-default:"587"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+	From     string `env:"SMTP_FROM" env-default:"Task Master <no-reply@localhost>"`
+	// TLSMode is one of "none", "starttls" or "tls" (implicit TLS).
+	TLSMode string `env:"SMTP_TLS_MODE" env-default:"starttls"`
 }
 
+const (
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+)
+
 const (
 	EnvProd = "prod"
 	EnvDev  = "dev"
@@ -37,5 +209,9 @@ func MustInit(path string) *Config {
 		panic(err)
 	}
 
+	if err := cfg.Password.Validate(); err != nil {
+		panic(err)
+	}
+
 	return &cfg
 }
@@ -0,0 +1,172 @@
+// Package digest sends users a periodic summary of their due, overdue and
+// recently completed tasks.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+// UnsubscribeAction is the action of the signed token in unsubscribe links.
+const UnsubscribeAction = "digest_unsubscribe"
+
+type Job struct {
+	store    *storage.Storage
+	notifier notify.Notifier
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewJob(store *storage.Storage, notifier notify.Notifier, config *config.Config, logger *slog.Logger) *Job {
+	return &Job{
+		store:    store,
+		notifier: notifier,
+		config:   config,
+		log:      logger,
+	}
+}
+
+// Run sends every digest whose scheduled time has passed and that has not
+// been sent yet. It is meant to be called periodically by the scheduler.
+func (j *Job) Run(ctx context.Context) error {
+	users, err := j.store.Users.GetDigestSubscribers()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		scheduledAt, ok := scheduledAt(&user, now)
+		if !ok {
+			continue
+		}
+
+		// The digest is queued in the transaction that claims it, so a
+		// failure releases the claim and the next run tries again.
+		err := j.store.Transaction(func(tx *storage.Storage) error {
+			claimed, err := tx.Users.ClaimDigest(user.ID, scheduledAt, now)
+			if err != nil || !claimed {
+				return err
+			}
+
+			return j.send(ctx, tx, &user, scheduledAt)
+		})
+		if err != nil {
+			j.log.Error("failed to send digest", slog.Uint64("user_id", uint64(user.ID)), slog.Any("error", err))
+		}
+	}
+
+	return nil
+}
+
+func (j *Job) send(ctx context.Context, tx *storage.Storage, user *models.User, scheduledAt time.Time) error {
+	loc := scheduledAt.Location()
+	y, m, d := scheduledAt.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+	yesterday := today.AddDate(0, 0, -1)
+
+	dueToday, err := tx.Tasks.GetDueTasks(user.ID, today, tomorrow)
+	if err != nil {
+		return err
+	}
+
+	overdue, err := tx.Tasks.GetOverdueTasks(user.ID, today)
+	if err != nil {
+		return err
+	}
+
+	completed, err := tx.Tasks.GetCompletedTasks(user.ID, yesterday, today)
+	if err != nil {
+		return err
+	}
+
+	if len(dueToday) == 0 && len(overdue) == 0 && len(completed) == 0 {
+		return nil
+	}
+
+	inLocation(dueToday, loc)
+	inLocation(overdue, loc)
+
+	unsubscribeURL, err := j.unsubscribeURL(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return notify.NotifyTx(ctx, j.notifier, tx, notify.Message{
+		UserID:  user.ID,
+		To:      user.VerifiedEmail(),
+		Kind:    notify.KindDigest,
+		Subject: fmt.Sprintf("Your tasks for %s", today.Format("Mon, 02 Jan")),
+		Body:    fmt.Sprintf("%d due today, %d overdue, %d completed yesterday", len(dueToday), len(overdue), len(completed)),
+		Data: map[string]any{
+			"Username":           user.Username,
+			"Date":               today,
+			"DueToday":           dueToday,
+			"Overdue":            overdue,
+			"CompletedYesterday": completed,
+			"UnsubscribeURL":     unsubscribeURL,
+		},
+	})
+}
+
+func (j *Job) unsubscribeURL(userID uint) (string, error) {
+	token, err := utils.SignActionToken(userID, UnsubscribeAction, 0, j.config.JWT.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/digest/unsubscribe?token=%s", j.config.HttpServer.PublicURL, url.QueryEscape(token)), nil
+}
+
+// inLocation moves due dates into the user's time zone, in which the
+// digest shows them.
+func inLocation(tasks []models.Task, loc *time.Location) {
+	for i := range tasks {
+		if tasks[i].DueAt != nil {
+			dueAt := tasks[i].DueAt.In(loc)
+			tasks[i].DueAt = &dueAt
+		}
+	}
+}
+
+// scheduledAt returns the most recent time, at or before now, at which the
+// user's digest is due. It reports false if no digest is due today.
+func scheduledAt(user *models.User, now time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	clock, err := time.Parse("15:04", user.DigestTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	y, m, d := local.Date()
+	at := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, loc)
+
+	if at.After(local) {
+		return time.Time{}, false
+	}
+
+	if user.DigestFrequency == models.DigestWeekly && local.Weekday() != user.DigestWeekday {
+		return time.Time{}, false
+	}
+
+	return at, true
+}
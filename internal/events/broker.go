@@ -0,0 +1,184 @@
+// Package events fans out the change log to connected clients. New events
+// are announced through PostgreSQL LISTEN/NOTIFY, so clients connected to
+// any server instance receive every change.
+package events
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	// subscriberBuffer is how many events a slow subscriber may lag behind
+	// before it is dropped. Dropped clients reconnect and resume from their
+	// last event ID.
+	subscriberBuffer = 64
+	reconnectDelay   = 5 * time.Second
+)
+
+type subscriber struct {
+	userID uint
+	ch     chan models.Event
+}
+
+type Broker struct {
+	dsn   string
+	store *storage.Storage
+	log   *slog.Logger
+
+	mu          sync.Mutex
+	subscribers map[uint]map[*subscriber]struct{}
+}
+
+func NewBroker(dsn string, store *storage.Storage, logger *slog.Logger) *Broker {
+	return &Broker{
+		dsn:         dsn,
+		store:       store,
+		log:         logger,
+		subscribers: map[uint]map[*subscriber]struct{}{},
+	}
+}
+
+// Subscribe returns a channel receiving the user's events as they are
+// committed. The channel is closed when the subscriber falls behind or the
+// broker loses its database connection; callers should then resume from the
+// event log. cancel must be called when the subscriber goes away.
+func (b *Broker) Subscribe(userID uint) (events <-chan models.Event, cancel func()) {
+	sub := &subscriber{userID: userID, ch: make(chan models.Event, subscriberBuffer)}
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = map[*subscriber]struct{}{}
+	}
+	b.subscribers[userID][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(sub)
+	}
+}
+
+// remove closes and forgets sub. b.mu must be held.
+func (b *Broker) remove(sub *subscriber) {
+	subs := b.subscribers[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+	close(sub.ch)
+}
+
+// Run listens for new events until ctx is cancelled, reconnecting to the
+// database when the connection is lost.
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.log.Error("event listener disconnected", slog.Any("error", err))
+		b.dropAll()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{storage.EventsChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, userID, ok := parseNotification(n.Payload)
+		if !ok || !b.hasSubscribers(userID) {
+			continue
+		}
+
+		event, err := b.store.Events.GetEvent(id)
+		if err != nil {
+			b.log.Error("failed to load event", slog.Uint64("event_id", id), slog.Any("error", err))
+			continue
+		}
+
+		b.publish(*event)
+	}
+}
+
+func (b *Broker) hasSubscribers(userID uint) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[userID]) > 0
+}
+
+func (b *Broker) publish(event models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// dropAll disconnects every subscriber, since events may have been missed
+// while the listener was down.
+func (b *Broker) dropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+func parseNotification(payload string) (id uint64, userID uint, ok bool) {
+	idPart, userPart, found := strings.Cut(payload, ":")
+	if !found {
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	user, err := strconv.ParseUint(userPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return id, uint(user), true
+}
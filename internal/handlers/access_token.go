@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	accessTokenBytes = 32
+	// accessTokenPrefixLength is how much of a token is kept in the clear,
+	// including "tmp_".
+	accessTokenPrefixLength = 12
+)
+
+type AccessTokenHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewAccessTokenHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+// @Summary List personal access tokens
+// @Description List the personal access tokens of the current user, newest first. The tokens themselves are never shown again after creation.
+// @Tags User
+// @Produce json
+// @Success 200 {object} []models.PersonalAccessToken
+// @Failure 500 {object} response.Response
+// @Router /user/tokens [get]
+// @Security ApiKeyAuth
+func (h *AccessTokenHandler) GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	tokens, err := h.store.AccessTokens.GetAccessTokens(user.ID)
+	if err != nil {
+		h.log.Error("failed to get access tokens", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, tokens)
+}
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// ExpiresAt is optional; tokens without it do not expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateAccessTokenResponse struct {
+	models.PersonalAccessToken
+	// Token is only returned here.
+	Token string `json:"token"`
+}
+
+// @Summary Create a personal access token
+// @Description Create a token for scripts and CI, sent as "Authorization: Bearer tmp_...". It can only be used for its scopes.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param token body CreateAccessTokenRequest true "Token details"
+// @Success 201 {object} CreateAccessTokenResponse
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/tokens [post]
+// @Security ApiKeyAuth
+func (h *AccessTokenHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload CreateAccessTokenRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	for _, scope := range payload.Scopes {
+		if !auth.IsScope(scope) {
+			response.BadRequest(w, "Unknown scope: "+scope)
+			return
+		}
+		// A token cannot be used to create a more powerful one.
+		if !middleware.HasScope(r.Context(), scope) {
+			response.Forbidden(w, "Token is missing the "+scope+" scope")
+			return
+		}
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		response.BadRequest(w, "expires_at must be in the future")
+		return
+	}
+
+	secret, err := utils.RandomToken(accessTokenBytes)
+	if err != nil {
+		h.log.Error("failed to generate access token", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+
+	pat := models.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      payload.Name,
+		Prefix:    token[:accessTokenPrefixLength],
+		TokenHash: utils.HashToken(token),
+		Scopes:    models.StringList(payload.Scopes),
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := h.store.AccessTokens.CreateAccessToken(&pat); err != nil {
+		h.log.Error("failed to create access token", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, CreateAccessTokenResponse{PersonalAccessToken: pat, Token: token})
+}
+
+// @Summary Delete a personal access token
+// @Description Revoke a personal access token. It stops working immediately.
+// @Tags User
+// @Param id path int true "Token ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/tokens/{id} [delete]
+// @Security ApiKeyAuth
+func (h *AccessTokenHandler) DeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || tokenID < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	token, err := h.store.AccessTokens.GetAccessToken(uint(tokenID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFound(w, "Token not found")
+			return
+		}
+		h.log.Error("failed to get access token", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if token.UserID != user.ID {
+		response.NotFound(w, "Token not found")
+		return
+	}
+
+	if err := h.store.AccessTokens.DeleteAccessToken(token.ID); err != nil {
+		h.log.Error("failed to delete access token", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
@@ -1,39 +1,55 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/k1ender/task-master-go/internal/auth"
 	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
 	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
 	"github.com/k1ender/task-master-go/internal/response"
 	"github.com/k1ender/task-master-go/internal/storage"
 	"github.com/k1ender/task-master-go/internal/utils"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	store    *storage.Storage
-	validate *validator.Validate
-	config   *config.Config
-	log      *slog.Logger
+	store     *storage.Storage
+	denylist  *auth.Denylist
+	keys      *auth.KeySet
+	passwords *auth.Passwords
+	notifier  notify.Notifier
+	validate  *validator.Validate
+	config    *config.Config
+	log       *slog.Logger
 }
 
-func NewAuthHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *AuthHandler {
+func NewAuthHandler(store *storage.Storage, denylist *auth.Denylist, keys *auth.KeySet, passwords *auth.Passwords, notifier notify.Notifier, validator *validator.Validate, config *config.Config, logger *slog.Logger) *AuthHandler {
 	return &AuthHandler{
-		store:    store,
-		validate: validator,
-		config:   config,
-		log:      logger,
+		store:     store,
+		denylist:  denylist,
+		keys:      keys,
+		passwords: passwords,
+		notifier:  notifier,
+		validate:  validator,
+		config:    config,
+		log:       logger,
 	}
 }
 
 type RegisterUserRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required,min=8"`
+	// Username is 3 to 32 letters, digits, dots, underscores and hyphens.
+	Username string `json:"username" validate:"required,username"`
+	Email    string `json:"email" validate:"omitempty,email"`
+	// Password must satisfy the password policy.
+	Password string `json:"password" validate:"required"`
 }
 
 // @Summary Register a new user
@@ -42,8 +58,9 @@ type RegisterUserRequest struct {
 // @Accept json
 // @Produce json
 // @Param user body RegisterUserRequest true "User details"
-// @Success 201 {object} models.User
+// @Success 201 {object} TokenResponse
 // @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /register [post]
 func (h *AuthHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +77,12 @@ func (h *AuthHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed_password, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err := h.passwords.Check(payload.Password, payload.Username); err != nil {
+		writePasswordCheckError(w, err, h.log)
+		return
+	}
+
+	hashed_password, err := h.passwords.Hash(payload.Password)
 	if err != nil {
 		h.log.Error("failed to hash password", slog.Any("error", err))
 		response.InternalServerError(w)
@@ -69,7 +91,11 @@ func (h *AuthHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	user := models.User{
 		Username: payload.Username,
-		Password: string(hashed_password),
+		Password: hashed_password,
+	}
+	if payload.Email != "" {
+		email := strings.ToLower(payload.Email)
+		user.Email = &email
 	}
 
 	err = h.store.Users.CreateUser(&user)
@@ -81,35 +107,50 @@ func (h *AuthHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 				response.BadRequest(w, "Username already exists")
 				return
 			}
+			if err.ConstraintName == "idx_users_email" {
+				response.Conflict(w, "Email already in use")
+				return
+			}
 		}
 		response.InternalServerError(w)
 		return
 	}
 
-	ss, err := utils.SignToken(user.ID, h.config.JWT.Secret)
+	var tokens *TokenResponse
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		tokens, err = startSession(tx, h.keys, h.config, &user, r)
+		return err
+	})
 	if err != nil {
-		h.log.Error("failed to sign token", slog.Any("error", err))
+		h.log.Error("failed to issue tokens", slog.Any("error", err))
 		response.InternalServerError(w)
 		return
 	}
 
-	response.Created(w, map[string]string{"token": ss})
+	if err := sendEmailVerification(r.Context(), h.notifier, h.config, &user); err != nil {
+		h.log.Error("failed to send email verification", slog.Any("error", err))
+	}
+
+	response.Created(w, tokens)
 }
 
+// LoginUserRequest identifies the user by username or by email address.
 type LoginUserRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required,min=8"`
+	Username string `json:"username" validate:"required_without=Email"`
+	Email    string `json:"email" validate:"omitempty,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 // @Summary Login a user
-// @Description Login a user
+// @Description Login a user. Unknown users and wrong passwords get the same 401. Repeated failures for an account or from an address delay further attempts and then lock them out for a while with 429. If two-factor authentication is enabled, the response is an MFAChallengeResponse instead, to be completed at /login/mfa.
 // @Tags Auth
 // @Accept json
 // @Produce json
 // @Param user body LoginUserRequest true "User details"
-// @Success 200 {object} response.Response
+// @Success 200 {object} TokenResponse
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
+// @Failure 429 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /login [post]
 func (h *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
@@ -126,30 +167,333 @@ func (h *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.store.Users.GetUserByUsername(payload.Username)
+	login := payload.Username
+	var (
+		user *models.User
+		err  error
+	)
+	if payload.Email != "" {
+		login = strings.ToLower(payload.Email)
+		user, err = h.store.Users.GetUserByEmail(login)
+	} else {
+		user, err = h.store.Users.GetUserByUsername(login)
+	}
 
 	if err != nil {
-		h.log.Error("failed to get user", slog.Any("error", err))
-		if err == gorm.ErrRecordNotFound {
-			response.NotFound(w, "User not found")
+		if err != gorm.ErrRecordNotFound {
+			h.log.Error("failed to get user", slog.Any("error", err))
+			response.InternalServerError(w)
 			return
 		}
+		user = nil
+	}
+
+	limits := []loginLimit{accountLimit(h.config, user, login), ipLimit(h.config, r)}
+	wait, err := reserveLoginAttempt(h.store, h.config, limits...)
+	if err != nil {
+		h.log.Error("failed to reserve login attempt", slog.Any("error", err))
 		response.InternalServerError(w)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
-		h.log.Error("failed to compare password", slog.Any("error", err))
-		response.Unauthorized(w, "Unauthorized")
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
 		return
 	}
 
-	ss, err := utils.SignToken(user.ID, h.config.JWT.Secret)
+	if !checkPassword(h.store, h.passwords, user, payload.Password, h.log) {
+		response.Unauthorized(w, invalidCredentialsMessage)
+		return
+	}
+
+	if err := releaseLoginAttempt(h.store, limits...); err != nil {
+		h.log.Error("failed to release login attempt", slog.Any("error", err))
+	}
+
+	// Failures are kept until the second factor is also right, or the
+	// password would reset the count for someone guessing codes.
+	if user.MFAEnabled() {
+		token, err := utils.SignActionToken(user.ID, mfaLoginAction, h.config.Auth.MFAChallengeTTL, h.config.JWT.Secret)
+		if err != nil {
+			h.log.Error("failed to sign mfa challenge", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+
+		response.OK(w, MFAChallengeResponse{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	var tokens *TokenResponse
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if err := tx.LoginFailures.ClearLoginFailures(limits[0].key); err != nil {
+			return err
+		}
+
+		tokens, err = startSession(tx, h.keys, h.config, user, r)
+		return err
+	})
+	if err != nil {
+		h.log.Error("failed to issue tokens", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, tokens)
+}
+
+// MFAChallengeResponse is returned by /login instead of tokens when the user
+// has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// Code is a code from the authenticator or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token from /login and a code from the authenticator, or a recovery code, for tokens
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param login body LoginMFARequest true "Challenge token and code"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /login/mfa [post]
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var payload LoginMFARequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	userID, err := utils.ParseActionToken(payload.MFAToken, mfaLoginAction, h.config.JWT.Secret)
+	if err != nil {
+		response.Unauthorized(w, "Invalid or expired challenge")
+		return
+	}
+
+	limits := []loginLimit{accountLimit(h.config, &models.User{ID: userID}, ""), ipLimit(h.config, r)}
+	wait, err := reserveLoginAttempt(h.store, h.config, limits...)
+	if err != nil {
+		h.log.Error("failed to reserve login attempt", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	var tokens *TokenResponse
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		user, err := tx.Users.GetUser(userID)
+		if err != nil {
+			return err
+		}
+
+		if !user.MFAEnabled() {
+			return errInvalidSecondFactor
+		}
+
+		valid, err := verifySecondFactor(tx, user, payload.Code)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return errInvalidSecondFactor
+		}
+
+		if err := tx.LoginFailures.ClearLoginFailures(limits[0].key); err != nil {
+			return err
+		}
+
+		tokens, err = startSession(tx, h.keys, h.config, user, r)
+		return err
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errInvalidSecondFactor) {
+		response.Unauthorized(w, "Invalid code")
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to complete mfa login", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if err := releaseLoginAttempt(h.store, limits...); err != nil {
+		h.log.Error("failed to release login attempt", slog.Any("error", err))
+	}
+
+	response.OK(w, tokens)
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; using one again revokes every token descended from the same login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param token body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /token/refresh [post]
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	var (
+		tokens *TokenResponse
+		reused *models.Session
+	)
+
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		var err error
+		tokens, reused, err = exchangeRefreshToken(tx, h.keys, h.config, r, payload.RefreshToken, "")
+		return err
+	})
+
+	if err == nil && reused != nil {
+		h.log.Warn("refresh token reused, revoking session", slog.Uint64("user_id", uint64(reused.UserID)), slog.Uint64("session_id", uint64(reused.ID)))
+		if err := revokeSession(h.store, h.denylist, h.config, reused); err != nil {
+			h.log.Error("failed to revoke session", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+		response.Unauthorized(w, "Invalid refresh token")
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errInvalidRefreshToken) {
+		response.Unauthorized(w, "Invalid refresh token")
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to refresh token", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, tokens)
+}
+
+type LogoutRequest struct {
+	// RefreshToken, if given, is revoked along with the tokens issued from
+	// the same login.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// @Summary Log out
+// @Description End the session of the access token used for this request, revoking its access and refresh tokens. A refresh token passed in the body is revoked as well.
+// @Tags Auth
+// @Accept json
+// @Param token body LogoutRequest false "Refresh token to revoke"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /logout [post]
+// @Security ApiKeyAuth
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	claims := middleware.GetAuthClaimsFromContext(r.Context())
+
+	var payload LogoutRequest
+	if err := utils.ReadJSON(r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := h.store.RefreshTokens.RevokeRefreshTokenFamilyOf(user.ID, utils.HashToken(payload.RefreshToken)); err != nil {
+			h.log.Error("failed to revoke refresh token", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	if claims.SessionID != 0 {
+		session, err := h.store.Sessions.GetSession(claims.SessionID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			h.log.Error("failed to get session", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+
+		if err == nil {
+			if err := revokeSession(h.store, h.denylist, h.config, session); err != nil {
+				h.log.Error("failed to revoke session", slog.Any("error", err))
+				response.InternalServerError(w)
+				return
+			}
+		}
+	}
+
+	if claims.ID != "" {
+		if err := h.denylist.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+			h.log.Error("failed to revoke token", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	response.NoContent(w)
+}
+
+// @Summary Log out everywhere
+// @Description Revoke every access and refresh token issued to the user
+// @Tags Auth
+// @Success 204
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /logout/all [post]
+// @Security ApiKeyAuth
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		return revokeAllSessions(tx, user)
+	})
+
 	if err != nil {
-		h.log.Error("failed to sign token", slog.Any("error", err))
+		h.log.Error("failed to revoke tokens", slog.Any("error", err))
 		response.InternalServerError(w)
 		return
 	}
 
-	response.OK(w, map[string]string{"token": ss})
+	response.NoContent(w)
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+// verifyEmailAction is the action of email verification tokens. It names
+// the address, so that a link sent to an old address cannot verify a new
+// one.
+func verifyEmailAction(email string) string {
+	return "verify_email:" + email
+}
+
+// sendEmailVerification mails a verification link to the user's current,
+// unverified address.
+func sendEmailVerification(ctx context.Context, notifier notify.Notifier, cfg *config.Config, user *models.User) error {
+	if user.Email == nil {
+		return nil
+	}
+
+	token, err := utils.SignActionToken(user.ID, verifyEmailAction(*user.Email), cfg.Auth.EmailVerificationTTL, cfg.JWT.Secret)
+	if err != nil {
+		return err
+	}
+
+	return notifier.Notify(ctx, notify.Message{
+		UserID:  user.ID,
+		To:      *user.Email,
+		Kind:    notify.KindEmailVerification,
+		Subject: "Verify your email address",
+		Body:    "Use the link in this message to verify your email address.",
+		Data: map[string]any{
+			"Username":  user.Username,
+			"Email":     *user.Email,
+			"VerifyURL": cfg.HttpServer.PublicURL + "/email/verify?token=" + url.QueryEscape(token),
+			"ExpiresAt": time.Now().Add(cfg.Auth.EmailVerificationTTL),
+		},
+	})
+}
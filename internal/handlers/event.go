@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/events"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	sseHeartbeatInterval = 25 * time.Second
+	sseReplayBatch       = 500
+)
+
+type EventHandler struct {
+	store        *storage.Storage
+	broker       *events.Broker
+	authenticate middleware.Authenticator
+	config       *config.Config
+	log          *slog.Logger
+}
+
+func NewEventHandler(store *storage.Storage, broker *events.Broker, authenticate middleware.Authenticator, config *config.Config, logger *slog.Logger) *EventHandler {
+	return &EventHandler{
+		store:        store,
+		broker:       broker,
+		authenticate: authenticate,
+		config:       config,
+		log:          logger,
+	}
+}
+
+// @Summary Stream task changes
+// @Description Server-Sent Events stream of the user's task changes. Every event has an id; reconnect with the Last-Event-ID header (or the last_event_id query parameter) to resume. A "reset" event means the requested position is no longer in the log and the client should refetch its data. The stream ends with an "unauthorized" event when the token expires or is revoked; reconnect with a fresh token.
+// @Tags Event
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "Resume after this event"
+// @Param last_event_id query string false "Resume after this event"
+// @Success 200
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /events [get]
+// @Security ApiKeyAuth
+func (h *EventHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	credentials := newStreamCredentials(h.authenticate, r)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	var after uint64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			response.BadRequest(w, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// Subscribe before replaying, so nothing committed in between is lost.
+	live, cancel := h.broker.Subscribe(user.ID)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if after > 0 {
+		oldest, err := h.store.Events.OldestEventID()
+		if err != nil {
+			h.log.Error("failed to get oldest event", slog.Any("error", err))
+			return
+		}
+		if oldest == 0 || after+1 < oldest {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+
+		for {
+			batch, err := h.store.Events.GetEventsSince(user.ID, after, sseReplayBatch)
+			if err != nil {
+				h.log.Error("failed to replay events", slog.Any("error", err))
+				return
+			}
+
+			for _, event := range batch {
+				writeEvent(w, event)
+				after = event.ID
+			}
+
+			if len(batch) < sseReplayBatch {
+				break
+			}
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	recheck := time.NewTimer(credentials.NextCheck())
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-recheck.C:
+			if err := credentials.Check(); err != nil {
+				if !errors.Is(err, middleware.ErrUnauthorized) {
+					h.log.Error("failed to check stream token", slog.Any("error", err))
+				}
+				fmt.Fprint(w, "event: unauthorized\ndata: {}\n\n")
+				rc.Flush()
+				return
+			}
+			recheck.Reset(credentials.NextCheck())
+		case event, ok := <-live:
+			if !ok {
+				// Dropped by the broker; the client reconnects and resumes.
+				return
+			}
+			if event.ID <= after {
+				continue
+			}
+			writeEvent(w, event)
+			after = event.ID
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event models.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+}
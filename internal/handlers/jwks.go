@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+	log  *slog.Logger
+}
+
+func NewJWKSHandler(keys *auth.KeySet, logger *slog.Logger) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+		log:  logger,
+	}
+}
+
+// @Summary Get the token signing keys
+// @Description Public keys that verify access tokens, as a JSON Web Key Set. The response is not wrapped in the usual envelope. It is empty when tokens are signed with HS256.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	// Verifiers cache the set for at most JWKSMaxAge, which rotated keys
+	// wait out before they sign.
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSMaxAge.Seconds())))
+	if err := utils.WriteJSON(w, http.StatusOK, h.keys.JWKS()); err != nil {
+		h.log.Error("failed to write jwks", slog.Any("error", err))
+	}
+}
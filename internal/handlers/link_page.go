@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+//go:embed templates/link_page.html
+var linkPageFS embed.FS
+
+var linkPageTemplate = template.Must(template.ParseFS(linkPageFS, "templates/link_page.html"))
+
+// linkPage is served for the links in emails. Following a link only shows
+// the page; the action happens when its form is submitted, so that mail
+// scanners that open links do not trigger it.
+type linkPage struct {
+	Title   string
+	Message string
+	Error   string
+	// Action is where the form posts Token. Without it the page has no
+	// form.
+	Action string
+	Token  string
+	Button string
+	// NewPassword asks for a new password in the form.
+	NewPassword bool
+}
+
+func renderLinkPage(w http.ResponseWriter, status int, page linkPage, logger *slog.Logger) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The token in the page must not leak to other sites through framing
+	// or the referrer.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := linkPageTemplate.Execute(w, page); err != nil {
+		logger.Error("failed to render page", slog.Any("error", err))
+	}
+}
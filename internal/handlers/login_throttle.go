@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+const (
+	// loginFreeFailures is how many failures are allowed before further
+	// attempts are delayed. Each failure after that doubles the delay, up
+	// to maxLoginDelay, until the key is locked out.
+	loginFreeFailures = 3
+	maxLoginDelay     = 30 * time.Second
+
+	invalidCredentialsMessage = "Invalid credentials"
+	tooManyAttemptsMessage    = "Too many failed attempts, try again later"
+)
+
+// loginLimit is a key failed logins are counted under, with the number of
+// failures that locks it.
+type loginLimit struct {
+	key         string
+	maxFailures int
+}
+
+// accountLimit counts failures against the user, or against the name that
+// was tried if there is no such user, so unknown names lock out too.
+func accountLimit(cfg *config.Config, user *models.User, login string) loginLimit {
+	key := "login:" + strings.ToLower(login)
+	if user != nil {
+		key = "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return loginLimit{key: key, maxFailures: cfg.Auth.LoginMaxFailures}
+}
+
+func ipLimit(cfg *config.Config, r *http.Request) loginLimit {
+	return loginLimit{key: "ip:" + utils.ClientIP(r), maxFailures: cfg.Auth.LoginIPMaxFailures}
+}
+
+// reserveLoginAttempt returns how long to wait before a login attempt under
+// limits is accepted, or 0 if it may be made now. An accepted attempt is
+// counted as a failure before the credentials are checked, so concurrent
+// attempts cannot all pass the check and exceed the limit; when the
+// credentials turn out right, releaseLoginAttempt takes it back.
+func reserveLoginAttempt(store *storage.Storage, cfg *config.Config, limits ...loginLimit) (time.Duration, error) {
+	wait, err := loginRetryAfter(store, cfg, limits...)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		failures, err := store.LoginFailures.RecordLoginFailure(limit.key, now, now.Add(-cfg.Auth.LoginLockout))
+		if err != nil {
+			return 0, err
+		}
+
+		// Another attempt took the last one allowed.
+		if failures > limit.maxFailures {
+			return cfg.Auth.LoginLockout, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// releaseLoginAttempt takes back the failures reserveLoginAttempt counted
+// for an attempt whose credentials were right.
+func releaseLoginAttempt(store *storage.Storage, limits ...loginLimit) error {
+	for _, limit := range limits {
+		if err := store.LoginFailures.ReleaseLoginFailure(limit.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loginRetryAfter returns how long to wait before the next login attempt
+// under limits is accepted, or 0 if it may be made now.
+func loginRetryAfter(store *storage.Storage, cfg *config.Config, limits ...loginLimit) (time.Duration, error) {
+	keys := make([]string, len(limits))
+	for i, limit := range limits {
+		keys[i] = limit.key
+	}
+
+	failures, err := store.LoginFailures.GetLoginFailures(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	now := time.Now()
+	for _, failure := range failures {
+		for _, limit := range limits {
+			if limit.key != failure.Key {
+				continue
+			}
+
+			blockedUntil := failure.LastFailedAt.Add(loginDelay(cfg, failure.Failures, limit.maxFailures))
+			wait = max(wait, blockedUntil.Sub(now))
+		}
+	}
+
+	return wait, nil
+}
+
+// loginDelay is how long after the last of failures the next attempt has to
+// wait.
+func loginDelay(cfg *config.Config, failures, maxFailures int) time.Duration {
+	if failures >= maxFailures {
+		return cfg.Auth.LoginLockout
+	}
+
+	if failures <= loginFreeFailures {
+		return 0
+	}
+
+	// Capping the shift keeps large failure counts from overflowing.
+	shift := min(failures-loginFreeFailures-1, 16)
+	return min(time.Second<<shift, maxLoginDelay, cfg.Auth.LoginLockout)
+}
+
+// checkPassword reports whether password is the user's. For a nil user it
+// checks against a dummy hash, so that unknown users take as long to
+// reject. A hash made with an outdated algorithm or parameters is replaced;
+// failing to do so does not fail the login.
+func checkPassword(store *storage.Storage, passwords *auth.Passwords, user *models.User, password string, logger *slog.Logger) bool {
+	if user == nil {
+		passwords.VerifyDummy(password)
+		return false
+	}
+
+	rehash, err := passwords.Verify(user.Password, password)
+	if err != nil {
+		if !errors.Is(err, auth.ErrPasswordMismatch) {
+			logger.Error("failed to verify password", slog.Any("error", err))
+		}
+		return false
+	}
+
+	if rehash {
+		hash, err := passwords.Hash(password)
+		if err == nil {
+			err = store.Users.UpdateUser(user, map[string]any{"password": hash})
+		}
+		if err != nil {
+			logger.Error("failed to rehash password", slog.Any("error", err))
+		}
+	}
+
+	return true
+}
+
+// setRetryAfter sets the Retry-After header to wait, rounded up to whole
+// seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	setRetryAfter(w, wait)
+	response.TooManyRequests(w, tooManyAttemptsMessage)
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// mfaLoginAction is the action of the challenge tokens that carry a
+	// login from the password step to the code step.
+	mfaLoginAction = "mfa_login"
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var errInvalidSecondFactor = errors.New("invalid second factor")
+
+type MFAHandler struct {
+	store     *storage.Storage
+	passwords *auth.Passwords
+	validate  *validator.Validate
+	config    *config.Config
+	log       *slog.Logger
+}
+
+func NewMFAHandler(store *storage.Storage, passwords *auth.Passwords, validator *validator.Validate, config *config.Config, logger *slog.Logger) *MFAHandler {
+	return &MFAHandler{
+		store:     store,
+		passwords: passwords,
+		validate:  validator,
+		config:    config,
+		log:       logger,
+	}
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// @Summary Start TOTP enrollment
+// @Description Generate a new TOTP secret for the current user. Two-factor authentication is enabled once a code from the authenticator is confirmed.
+// @Tags User
+// @Produce json
+// @Success 200 {object} TOTPEnrollmentResponse
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/mfa/totp [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	if user.MFAEnabled() {
+		response.Conflict(w, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		h.log.Error("failed to generate totp secret", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if err := h.store.Users.UpdateUser(user, map[string]any{"totp_secret": secret}); err != nil {
+		h.log.Error("failed to update user", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(h.config.Auth.TOTPIssuer, user.Username, secret),
+	})
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with the first code from the authenticator. The response holds one-time recovery codes, which are not shown again.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param code body ConfirmTOTPRequest true "Code from the authenticator"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/mfa/totp/confirm [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload ConfirmTOTPRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if user.MFAEnabled() {
+		response.Conflict(w, "Two-factor authentication is already enabled")
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		response.BadRequest(w, "TOTP enrollment has not been started")
+		return
+	}
+
+	counter, ok := auth.ValidateTOTP(user.TOTPSecret, strings.TrimSpace(payload.Code), user.TOTPCounter, time.Now())
+	if !ok {
+		response.BadRequest(w, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		h.log.Error("failed to generate recovery codes", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if _, err := tx.Users.ClaimTOTPCounter(user.ID, counter); err != nil {
+			return err
+		}
+
+		if err := tx.Users.UpdateUser(user, map[string]any{"totp_enabled_at": time.Now()}); err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes.ReplaceRecoveryCodes(user.ID, hashes)
+	})
+	if err != nil {
+		h.log.Error("failed to enable totp", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+	// Code is a code from the authenticator or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn off TOTP for the current user and delete their recovery codes. Requires the password and a code from the authenticator or a recovery code.
+// @Tags User
+// @Accept json
+// @Param credentials body DisableTOTPRequest true "Password and code"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/mfa/totp/disable [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload DisableTOTPRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if !user.MFAEnabled() {
+		response.BadRequest(w, "Two-factor authentication is not enabled")
+		return
+	}
+
+	if _, err := h.passwords.Verify(user.Password, payload.Password); err != nil {
+		if !errors.Is(err, auth.ErrPasswordMismatch) {
+			h.log.Error("failed to verify password", slog.Any("error", err))
+		}
+		response.BadRequest(w, "Password is incorrect")
+		return
+	}
+
+	var valid bool
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		var err error
+		if valid, err = verifySecondFactor(tx, user, payload.Code); err != nil || !valid {
+			return err
+		}
+
+		err = tx.Users.UpdateUser(user, map[string]any{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes.DeleteRecoveryCodes(user.ID)
+	})
+	if err != nil {
+		h.log.Error("failed to disable totp", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if !valid {
+		response.BadRequest(w, "Invalid code")
+		return
+	}
+
+	response.NoContent(w)
+}
+
+type RegenerateRecoveryCodesRequest struct {
+	// Code is a code from the authenticator or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes of the current user. The old codes stop working.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param code body RegenerateRecoveryCodesRequest true "Code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/mfa/recovery-codes [post]
+// @Security ApiKeyAuth
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload RegenerateRecoveryCodesRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if !user.MFAEnabled() {
+		response.BadRequest(w, "Two-factor authentication is not enabled")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		h.log.Error("failed to generate recovery codes", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	var valid bool
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		var err error
+		if valid, err = verifySecondFactor(tx, user, payload.Code); err != nil || !valid {
+			return err
+		}
+
+		return tx.RecoveryCodes.ReplaceRecoveryCodes(user.ID, hashes)
+	})
+	if err != nil {
+		h.log.Error("failed to regenerate recovery codes", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if !valid {
+		response.BadRequest(w, "Invalid code")
+		return
+	}
+
+	response.OK(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code of the user and
+// uses it up, so that it cannot be presented again.
+func verifySecondFactor(tx *storage.Storage, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if counter, ok := auth.ValidateTOTP(user.TOTPSecret, code, user.TOTPCounter, time.Now()); ok {
+		return tx.Users.ClaimTOTPCounter(user.ID, counter)
+	}
+
+	return tx.RecoveryCodes.UseRecoveryCode(user.ID, utils.HashToken(normalizeRecoveryCode(code)))
+}
+
+// newRecoveryCodes returns recovery codes formatted for display, such as
+// "k3vq7-mx2pa", and their hashes for storage.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, recoveryCodeLength*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, utils.HashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
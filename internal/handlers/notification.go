@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+)
+
+type NotificationHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewNotificationHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+type NotificationsResponse struct {
+	UnreadCount   int64                 `json:"unread_count"`
+	Notifications []models.Notification `json:"notifications"`
+}
+
+// @Summary Get notifications
+// @Description Get the most recent notifications of the user together with the number of unread ones
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Param unread query bool false "Only return unread notifications"
+// @Param limit query int false "Maximum number of notifications (default 50, max 200)"
+// @Success 200 {object} NotificationsResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /notifications [get]
+// @Security ApiKeyAuth
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	limit := defaultNotificationLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.BadRequest(w, "Bad Request")
+			return
+		}
+		limit = min(n, maxNotificationLimit)
+	}
+
+	notifications, err := h.store.Notifications.GetNotifications(user.ID, unreadOnly, limit)
+	if err != nil {
+		h.log.Error("failed to get notifications", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	unread, err := h.store.Notifications.CountUnread(user.ID)
+	if err != nil {
+		h.log.Error("failed to count unread notifications", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, NotificationsResponse{UnreadCount: unread, Notifications: notifications})
+}
+
+// @Summary Mark a notification as read
+// @Description Mark a notification as read
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /notifications/{id}/read [post]
+// @Security ApiKeyAuth
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	found, err := h.store.Notifications.MarkRead(user.ID, uint(id), time.Now())
+	if err != nil {
+		h.log.Error("failed to mark notification read", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if !found {
+		response.NotFound(w, "Notification not found")
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// @Summary Mark all notifications as read
+// @Description Mark all notifications as read
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Success 204
+// @Failure 500 {object} response.Response
+// @Router /notifications/read-all [post]
+// @Security ApiKeyAuth
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	if err := h.store.Notifications.MarkAllRead(user.ID, time.Now()); err != nil {
+		h.log.Error("failed to mark notifications read", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
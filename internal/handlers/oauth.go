@@ -0,0 +1,724 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	authorizationCodeBytes = 32
+	authorizationCodeTTL   = time.Minute
+)
+
+//go:embed templates/oauth_consent.html
+var consentFS embed.FS
+
+var consentTemplate = template.Must(template.ParseFS(consentFS, "templates/oauth_consent.html"))
+
+// OAuthHandler is an OAuth 2.1 authorization server. Clients get codes
+// through the authorization code flow with PKCE and exchange them for the
+// same access and refresh tokens a login returns, limited to the granted
+// scopes.
+type OAuthHandler struct {
+	store     *storage.Storage
+	denylist  *auth.Denylist
+	keys      *auth.KeySet
+	passwords *auth.Passwords
+	config    *config.Config
+	log       *slog.Logger
+}
+
+func NewOAuthHandler(store *storage.Storage, denylist *auth.Denylist, keys *auth.KeySet, passwords *auth.Passwords, config *config.Config, logger *slog.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		store:     store,
+		denylist:  denylist,
+		keys:      keys,
+		passwords: passwords,
+		config:    config,
+		log:       logger,
+	}
+}
+
+// oauthError is an error response defined by RFC 6749.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// consentPage is the data of the consent screen.
+type consentPage struct {
+	ClientName          string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Error               string
+}
+
+// authorizeRequest is a validated authorization request.
+type authorizeRequest struct {
+	client        *models.OAuthClient
+	redirectURI   string
+	scopes        []string
+	state         string
+	codeChallenge string
+}
+
+// @Summary Authorize an OAuth client
+// @Description Show the consent screen of the authorization code flow, where the user signs in and allows or denies the client. PKCE with S256 is required.
+// @Tags OAuth
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "One of the client's redirect URIs; may be left out if it has only one"
+// @Param scope query string false "Space-separated scopes, by default all of the client's"
+// @Param state query string false "Returned unchanged to the client"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200
+// @Failure 400
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.readAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	h.renderConsent(w, http.StatusOK, req, "")
+}
+
+// @Summary Answer the OAuth consent screen
+// @Description Submitted by the consent screen. On approval with valid credentials, redirects to the client with an authorization code valid for one minute; otherwise with error=access_denied.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Success 303
+// @Failure 400
+// @Failure 401
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	req, ok := h.readAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		h.redirectError(w, r, req, &oauthError{Code: "access_denied", Description: "The user denied the request"})
+		return
+	}
+
+	login := r.PostForm.Get("username")
+	user, err := h.consentUser(login)
+	if err != nil {
+		h.log.Error("failed to get user", slog.Any("error", err))
+		h.renderError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	limits := []loginLimit{accountLimit(h.config, user, login), ipLimit(h.config, r)}
+	wait, err := reserveLoginAttempt(h.store, h.config, limits...)
+	if err != nil {
+		h.log.Error("failed to reserve login attempt", slog.Any("error", err))
+		h.renderError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		h.renderConsent(w, http.StatusTooManyRequests, req, tooManyAttemptsMessage)
+		return
+	}
+
+	if !checkPassword(h.store, h.passwords, user, r.PostForm.Get("password"), h.log) {
+		h.renderConsent(w, http.StatusUnauthorized, req, "Invalid username or password")
+		return
+	}
+
+	code, err := utils.RandomToken(authorizationCodeBytes)
+	if err != nil {
+		h.log.Error("failed to generate authorization code", slog.Any("error", err))
+		h.renderError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if user.MFAEnabled() {
+			valid, err := verifySecondFactor(tx, user, r.PostForm.Get("code"))
+			if err != nil {
+				return err
+			}
+			if !valid {
+				return errInvalidSecondFactor
+			}
+		}
+
+		if err := tx.LoginFailures.ClearLoginFailures(limits[0].key); err != nil {
+			return err
+		}
+
+		return tx.OAuth.CreateAuthorizationCode(&models.OAuthAuthorizationCode{
+			CodeHash:      utils.HashToken(code),
+			ClientID:      req.client.ClientID,
+			UserID:        user.ID,
+			RedirectURI:   req.redirectURI,
+			Scopes:        models.StringList(req.scopes),
+			CodeChallenge: req.codeChallenge,
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		})
+	})
+	if errors.Is(err, errInvalidSecondFactor) {
+		h.renderConsent(w, http.StatusUnauthorized, req, "Invalid authentication code")
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to create authorization code", slog.Any("error", err))
+		h.renderError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	if err := releaseLoginAttempt(h.store, limits...); err != nil {
+		h.log.Error("failed to release login attempt", slog.Any("error", err))
+	}
+
+	h.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// @Summary Get OAuth tokens
+// @Description Exchange an authorization code and its PKCE verifier (grant_type=authorization_code), or a refresh token (grant_type=refresh_token), for tokens. Confidential clients authenticate with HTTP Basic or client_secret; public clients send client_id. Refresh tokens rotate on every use.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param refresh_token formData string false "Refresh token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} OAuthTokenResponse
+// @Failure 400 {object} oauthError
+// @Failure 401 {object} oauthError
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		h.exchangeCode(w, r, client)
+	case "refresh_token":
+		h.refresh(w, r, client)
+	default:
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "unsupported_grant_type"})
+	}
+}
+
+func (h *OAuthHandler) exchangeCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	var (
+		tokens *TokenResponse
+		reused *uint
+	)
+
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		code, err := tx.OAuth.GetAuthorizationCodeForUpdate(utils.HashToken(r.PostForm.Get("code")))
+		if err != nil {
+			return err
+		}
+
+		if code.ClientID != client.ClientID {
+			return errInvalidGrant
+		}
+
+		// A code presented twice may have been intercepted, so the tokens
+		// issued for it are revoked (RFC 6749, section 4.1.2).
+		if code.UsedAt != nil {
+			reused = code.SessionID
+			return nil
+		}
+
+		if time.Now().After(code.ExpiresAt) {
+			return errInvalidGrant
+		}
+
+		if redirectURI := r.PostForm.Get("redirect_uri"); redirectURI != "" && redirectURI != code.RedirectURI {
+			return errInvalidGrant
+		}
+
+		if !verifyCodeChallenge(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			return errInvalidGrant
+		}
+
+		user, err := tx.Users.GetUser(code.UserID)
+		if err != nil {
+			return err
+		}
+
+		var session *models.Session
+		if tokens, session, err = startClientSession(tx, h.keys, h.config, user, r, client.ClientID, code.Scopes); err != nil {
+			return err
+		}
+
+		return tx.OAuth.MarkAuthorizationCodeUsed(code, session.ID)
+	})
+
+	if err == nil && reused != nil {
+		h.log.Warn("authorization code reused, revoking session", slog.String("client_id", client.ClientID), slog.Uint64("session_id", uint64(*reused)))
+		if session, err := h.store.Sessions.GetSession(*reused); err == nil {
+			if err := revokeSession(h.store, h.denylist, h.config, session); err != nil {
+				h.log.Error("failed to revoke session", slog.Any("error", err))
+			}
+		}
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errInvalidGrant) {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to exchange authorization code", slog.Any("error", err))
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, oauthTokens(tokens))
+}
+
+func (h *OAuthHandler) refresh(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	var (
+		tokens *TokenResponse
+		reused *models.Session
+	)
+
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		var err error
+		tokens, reused, err = exchangeRefreshToken(tx, h.keys, h.config, r, r.PostForm.Get("refresh_token"), client.ClientID)
+		return err
+	})
+
+	if err == nil && reused != nil {
+		h.log.Warn("refresh token reused, revoking session", slog.String("client_id", client.ClientID), slog.Uint64("session_id", uint64(reused.ID)))
+		if err := revokeSession(h.store, h.denylist, h.config, reused); err != nil {
+			h.log.Error("failed to revoke session", slog.Any("error", err))
+		}
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errInvalidRefreshToken) {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to refresh token", slog.Any("error", err))
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, oauthTokens(tokens))
+}
+
+// @Summary Revoke an OAuth token
+// @Description Revoke an access or refresh token issued to the client (RFC 7009). Revoking a refresh token ends the whole grant. Unknown tokens are ignored.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200
+// @Failure 401 {object} oauthError
+// @Router /oauth/revoke [post]
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	if claims, err := utils.ParseToken(token, h.keys); err == nil {
+		if claims.ClientID == client.ClientID && claims.ID != "" {
+			if err := h.denylist.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+				h.log.Error("failed to revoke token", slog.Any("error", err))
+				writeOAuthJSON(w, http.StatusServiceUnavailable, &oauthError{Code: "temporarily_unavailable"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	session, err := h.refreshTokenSession(token)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.log.Error("failed to get refresh token", slog.Any("error", err))
+		writeOAuthJSON(w, http.StatusServiceUnavailable, &oauthError{Code: "temporarily_unavailable"})
+		return
+	}
+
+	if err == nil && session.ClientID == client.ClientID && session.RevokedAt == nil {
+		if err := revokeSession(h.store, h.denylist, h.config, session); err != nil {
+			h.log.Error("failed to revoke session", slog.Any("error", err))
+			writeOAuthJSON(w, http.StatusServiceUnavailable, &oauthError{Code: "temporarily_unavailable"})
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary Introspect an OAuth access token
+// @Description Tell a confidential client whether an access token issued to it is active, and for whom and which scopes (RFC 7662)
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access token"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 401 {object} oauthError
+// @Router /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest, &oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	if !client.Confidential() {
+		writeOAuthJSON(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: "Only confidential clients can introspect tokens"})
+		return
+	}
+
+	inactive := IntrospectionResponse{Active: false}
+
+	claims, err := utils.ParseToken(r.PostForm.Get("token"), h.keys)
+	if err != nil || claims.ClientID != client.ClientID {
+		writeOAuthJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	if h.denylist.IsRevoked(claims.ID) || h.denylist.IsSessionRevoked(claims.SessionID) {
+		writeOAuthJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	user, err := h.store.Users.GetUser(claims.UserID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			h.log.Error("failed to get user", slog.Any("error", err))
+		}
+		writeOAuthJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	if claims.Generation != user.TokenGeneration {
+		writeOAuthJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Scopes, " "),
+		ClientID:  claims.ClientID,
+		Username:  user.Username,
+		TokenType: "Bearer",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       strconv.FormatUint(uint64(user.ID), 10),
+		Jti:       claims.ID,
+	})
+}
+
+// readAuthorizeRequest validates the parameters of an authorization request.
+// Without a valid client and redirect URI it shows an error page, since
+// redirecting could send the user anywhere; other errors are reported to
+// the client through the redirect URI.
+func (h *OAuthHandler) readAuthorizeRequest(w http.ResponseWriter, r *http.Request, params url.Values) (*authorizeRequest, bool) {
+	client, err := h.store.OAuth.GetClientByClientID(params.Get("client_id"))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			h.log.Error("failed to get oauth client", slog.Any("error", err))
+		}
+		h.renderError(w, http.StatusBadRequest, "Unknown client")
+		return nil, false
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		h.renderError(w, http.StatusBadRequest, "Invalid redirect URI")
+		return nil, false
+	}
+
+	req := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		state:         params.Get("state"),
+		codeChallenge: params.Get("code_challenge"),
+	}
+
+	if params.Get("response_type") != "code" {
+		h.redirectError(w, r, req, &oauthError{Code: "unsupported_response_type"})
+		return nil, false
+	}
+
+	if params.Get("code_challenge_method") != "S256" || len(req.codeChallenge) < 43 || len(req.codeChallenge) > 128 {
+		h.redirectError(w, r, req, &oauthError{Code: "invalid_request", Description: "PKCE with code_challenge_method=S256 is required"})
+		return nil, false
+	}
+
+	req.scopes = strings.Fields(params.Get("scope"))
+	if len(req.scopes) == 0 {
+		req.scopes = client.Scopes
+	}
+	for _, scope := range req.scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			h.redirectError(w, r, req, &oauthError{Code: "invalid_scope", Description: "The client may not request " + scope})
+			return nil, false
+		}
+	}
+
+	return req, true
+}
+
+// consentUser finds the user signing in on the consent screen by username
+// or email address. It returns nil if there is no such user, whose
+// password is then checked against a dummy hash like any other.
+func (h *OAuthHandler) consentUser(login string) (*models.User, error) {
+	user, err := h.store.Users.GetUserByUsername(login)
+	if errors.Is(err, gorm.ErrRecordNotFound) && strings.Contains(login, "@") {
+		user, err = h.store.Users.GetUserByEmail(strings.ToLower(login))
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// authenticateClient identifies the client from HTTP Basic credentials or
+// the client_id and client_secret form fields. Confidential clients must
+// present their secret.
+func (h *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	} else {
+		// RFC 6749 form-encodes the credentials before Basic encoding.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	}
+
+	client, err := h.store.OAuth.GetClientByClientID(clientID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.log.Error("failed to get oauth client", slog.Any("error", err))
+		writeOAuthJSON(w, http.StatusInternalServerError, &oauthError{Code: "server_error"})
+		return nil, false
+	}
+
+	if err != nil || (client.Confidential() && subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.ClientSecretHash)) != 1) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeOAuthJSON(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client"})
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (h *OAuthHandler) refreshTokenSession(token string) (*models.Session, error) {
+	refresh, err := h.store.RefreshTokens.GetRefreshTokenForUpdate(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	return h.store.Sessions.GetSessionByFamily(refresh.FamilyID)
+}
+
+func (h *OAuthHandler) renderConsent(w http.ResponseWriter, status int, req *authorizeRequest, message string) {
+	h.render(w, status, consentPage{
+		ClientName:          req.client.Name,
+		ClientID:            req.client.ClientID,
+		RedirectURI:         req.redirectURI,
+		Scope:               strings.Join(req.scopes, " "),
+		Scopes:              req.scopes,
+		State:               req.state,
+		CodeChallenge:       req.codeChallenge,
+		CodeChallengeMethod: "S256",
+		Error:               message,
+	})
+}
+
+func (h *OAuthHandler) renderError(w http.ResponseWriter, status int, message string) {
+	h.render(w, status, consentPage{Error: message})
+}
+
+func (h *OAuthHandler) render(w http.ResponseWriter, status int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The page takes credentials, so it must not be framed by other sites.
+	w.Header().Set("X-Frame-Options", "DENY")
+	// The form posts here, and the answer redirects to the client, which
+	// browsers check against form-action as well.
+	formAction := "'self'"
+	if origin := redirectOrigin(page.RedirectURI); origin != "" {
+		formAction += " " + origin
+	}
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action "+formAction+"; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		h.log.Error("failed to render consent page", slog.Any("error", err))
+	}
+}
+
+// redirectOrigin returns the CSP source matching a redirect URI: its origin
+// for web clients, or its scheme for native apps with a private-use scheme.
+func redirectOrigin(redirectURI string) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil || target.Scheme == "" {
+		return ""
+	}
+
+	switch target.Scheme {
+	case "http", "https":
+		// Characters that separate sources and directives would let a
+		// registered URI rewrite the policy.
+		if target.Host == "" || strings.ContainsAny(target.Host, ";,'") {
+			return ""
+		}
+		return target.Scheme + "://" + target.Host
+	default:
+		return target.Scheme + ":"
+	}
+}
+
+func (h *OAuthHandler) redirectError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, oerr *oauthError) {
+	params := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	h.redirect(w, r, req, params)
+}
+
+// redirect sends the user back to the client with params and the state of
+// the request.
+func (h *OAuthHandler) redirect(w http.ResponseWriter, r *http.Request, req *authorizeRequest, params url.Values) {
+	target, err := url.Parse(req.redirectURI)
+	if err != nil {
+		h.renderError(w, http.StatusBadRequest, "Invalid redirect URI")
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	query.Set("iss", h.config.HttpServer.PublicURL)
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against the S256
+// challenge of the authorization request (RFC 7636).
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func oauthTokens(tokens *TokenResponse) OAuthTokenResponse {
+	return OAuthTokenResponse{
+		AccessToken:  tokens.Token,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+	}
+}
+
+// writeOAuthJSON writes a token endpoint response. These follow RFC 6749
+// rather than the envelope of the rest of the API.
+func writeOAuthJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
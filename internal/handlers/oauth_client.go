@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	clientIDBytes     = 16
+	clientSecretBytes = 32
+)
+
+type OAuthClientHandler struct {
+	store    *storage.Storage
+	denylist *auth.Denylist
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewOAuthClientHandler(store *storage.Storage, denylist *auth.Denylist, validator *validator.Validate, config *config.Config, logger *slog.Logger) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		store:    store,
+		denylist: denylist,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+// @Summary List OAuth clients
+// @Description List the OAuth clients registered by the current user
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} []models.OAuthClient
+// @Failure 500 {object} response.Response
+// @Router /oauth/clients [get]
+// @Security ApiKeyAuth
+func (h *OAuthClientHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	clients, err := h.store.OAuth.GetClients(user.ID)
+	if err != nil {
+		h.log.Error("failed to get oauth clients", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, clients)
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	// Confidential clients get a secret and must authenticate at the token
+	// endpoint. Native and browser apps, which cannot keep a secret, should
+	// be public.
+	Confidential bool `json:"confidential"`
+}
+
+type CreateOAuthClientResponse struct {
+	models.OAuthClient
+	// ClientSecret is only returned here, and only for confidential clients.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// @Summary Register an OAuth client
+// @Description Register an application that can ask users for access through /oauth/authorize. Redirect URIs must be https, http on a loopback address, or a custom scheme for native apps.
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Param client body CreateOAuthClientRequest true "Client details"
+// @Success 201 {object} CreateOAuthClientResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /oauth/clients [post]
+// @Security ApiKeyAuth
+func (h *OAuthClientHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload CreateOAuthClientRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	for _, uri := range payload.RedirectURIs {
+		if !validRedirectURI(uri) {
+			response.BadRequest(w, "Invalid redirect URI: "+uri)
+			return
+		}
+	}
+
+	for _, scope := range payload.Scopes {
+		if !auth.IsScope(scope) {
+			response.BadRequest(w, "Unknown scope: "+scope)
+			return
+		}
+	}
+
+	clientID, err := utils.RandomToken(clientIDBytes)
+	if err != nil {
+		h.log.Error("failed to generate client id", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		UserID:       user.ID,
+		Name:         payload.Name,
+		RedirectURIs: models.StringList(payload.RedirectURIs),
+		Scopes:       models.StringList(payload.Scopes),
+	}
+
+	var secret string
+	if payload.Confidential {
+		if secret, err = utils.RandomToken(clientSecretBytes); err != nil {
+			h.log.Error("failed to generate client secret", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+		client.ClientSecretHash = utils.HashToken(secret)
+	}
+
+	if err := h.store.OAuth.CreateClient(&client); err != nil {
+		h.log.Error("failed to create oauth client", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, CreateOAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+// @Summary Delete an OAuth client
+// @Description Delete an OAuth client registered by the current user. Every grant users gave it is revoked.
+// @Tags OAuth
+// @Param id path int true "Client ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /oauth/clients/{id} [delete]
+// @Security ApiKeyAuth
+func (h *OAuthClientHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	client, err := h.store.OAuth.GetClient(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFound(w, "Client not found")
+			return
+		}
+		h.log.Error("failed to get oauth client", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if client.UserID != user.ID {
+		response.NotFound(w, "Client not found")
+		return
+	}
+
+	if err := h.store.OAuth.DeleteClient(client.ID); err != nil {
+		h.log.Error("failed to delete oauth client", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	sessions, err := h.store.Sessions.GetClientSessions(client.ClientID)
+	if err != nil {
+		h.log.Error("failed to get sessions", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	for i := range sessions {
+		if err := revokeSession(h.store, h.denylist, h.config, &sessions[i]); err != nil {
+			h.log.Error("failed to revoke session", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	response.NoContent(w)
+}
+
+// validRedirectURI accepts absolute URIs without a fragment that use https,
+// http on a loopback address, or a private scheme of a native app
+// (RFC 8252).
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		if u.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	case "javascript", "data", "file", "vbscript":
+		return false
+	default:
+		return true
+	}
+}
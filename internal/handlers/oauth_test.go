@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"gorm.io/gorm"
+)
+
+type fakeOAuthStore struct {
+	storage.OAuthStore
+	client *models.OAuthClient
+}
+
+func (s *fakeOAuthStore) GetClientByClientID(clientID string) (*models.OAuthClient, error) {
+	if clientID != s.client.ClientID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.client, nil
+}
+
+func TestConsentFormActionAllowsRedirect(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+		source      string
+	}{
+		{name: "web client", redirectURI: "https://client.example:8443/callback", source: "https://client.example:8443"},
+		{name: "native app", redirectURI: "com.example.app:/callback", source: "com.example.app:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &models.OAuthClient{
+				ClientID:     "client",
+				Name:         "Client",
+				RedirectURIs: models.StringList{tt.redirectURI},
+				Scopes:       models.StringList{"tasks:read"},
+			}
+			cfg := &config.Config{}
+			cfg.HttpServer.PublicURL = "https://tasks.example"
+			h := NewOAuthHandler(&storage.Storage{OAuth: &fakeOAuthStore{client: client}}, nil, nil, nil, cfg, slog.New(slog.DiscardHandler))
+
+			params := url.Values{
+				"response_type":         {"code"},
+				"client_id":             {client.ClientID},
+				"redirect_uri":          {tt.redirectURI},
+				"state":                 {"xyz"},
+				"code_challenge":        {strings.Repeat("a", 43)},
+				"code_challenge_method": {"S256"},
+			}
+
+			page := httptest.NewRecorder()
+			h.Authorize(page, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+params.Encode(), nil))
+			if page.Code != http.StatusOK {
+				t.Fatalf("consent page status = %d, want %d", page.Code, http.StatusOK)
+			}
+
+			params.Set("action", "deny")
+			r := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(params.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			answer := httptest.NewRecorder()
+			h.Approve(answer, r)
+
+			if answer.Code != http.StatusSeeOther {
+				t.Fatalf("answer status = %d, want %d", answer.Code, http.StatusSeeOther)
+			}
+
+			location, err := url.Parse(answer.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("invalid Location: %v", err)
+			}
+			if got := redirectOrigin(location.String()); got != tt.source {
+				t.Errorf("Location %s is not on %s", location, tt.source)
+			}
+			if location.Query().Get("error") != "access_denied" || location.Query().Get("state") != "xyz" {
+				t.Errorf("Location %s lacks the error and state", location)
+			}
+
+			sources := formActionSources(page.Header().Get("Content-Security-Policy"))
+			if !slices.Contains(sources, "'self'") || !slices.Contains(sources, tt.source) {
+				t.Errorf("form-action %q does not allow posting the form and redirecting to %s", sources, location)
+			}
+		})
+	}
+}
+
+func TestConsentFormActionIgnoresUnsafeHosts(t *testing.T) {
+	if got := redirectOrigin("https://a;script-src*/cb"); got != "" {
+		t.Errorf("redirectOrigin = %q, want none", got)
+	}
+}
+
+func formActionSources(policy string) []string {
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && fields[0] == "form-action" {
+			return fields[1:]
+		}
+	}
+	return nil
+}
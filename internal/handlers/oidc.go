@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/oidc"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateBytes  = 32
+	// oidcLoginTTL is how long the user has to finish logging in at the
+	// provider.
+	oidcLoginTTL = 10 * time.Minute
+	// maxUsernameAttempts bounds the search for a free username for a new
+	// user.
+	maxUsernameAttempts = 5
+	// usernameSuffixLength is the length of the suffix that makes a taken
+	// username free: a hyphen and four characters.
+	usernameSuffixLength = 5
+)
+
+var errIdentityNotLinked = errors.New("identity is not linked to a user")
+
+// OIDCHandler logs users in with an external OpenID Connect provider. An
+// identity at the provider is linked to one user, who is created on the
+// first login unless auto-provisioning is off.
+type OIDCHandler struct {
+	store     *storage.Storage
+	keys      *auth.KeySet
+	passwords *auth.Passwords
+	provider  *oidc.Provider
+	config    *config.Config
+	log       *slog.Logger
+}
+
+func NewOIDCHandler(store *storage.Storage, keys *auth.KeySet, passwords *auth.Passwords, provider *oidc.Provider, config *config.Config, logger *slog.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		store:     store,
+		keys:      keys,
+		passwords: passwords,
+		provider:  provider,
+		config:    config,
+		log:       logger,
+	}
+}
+
+// @Summary Start an OIDC login
+// @Description Redirect the browser to the OpenID Connect provider. After the user logs in there, the provider sends them back to /login/oidc/callback.
+// @Tags Auth
+// @Success 302
+// @Failure 500 {object} response.Response
+// @Router /login/oidc [get]
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	state, err := utils.RandomToken(oidcStateBytes)
+	if err != nil {
+		h.log.Error("failed to generate state", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	nonce, err := utils.RandomToken(oidcStateBytes)
+	if err != nil {
+		h.log.Error("failed to generate nonce", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	verifier, err := utils.RandomToken(oidcStateBytes)
+	if err != nil {
+		h.log.Error("failed to generate code verifier", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	target, err := h.provider.AuthCodeURL(r.Context(), state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		h.log.Error("failed to discover oidc provider", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	err = h.store.OIDC.CreateLoginState(&models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		h.log.Error("failed to create login state", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/login/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.config.HttpServer.PublicURL, "https://"),
+		// Lax, so the cookie comes along on the top-level redirect back from
+		// the provider.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// @Summary Finish an OIDC login
+// @Description The provider redirects here after the user logs in. The ID token is validated and the identity's user, created on first login, gets tokens. Users with two-factor authentication get an MFAChallengeResponse instead, to be completed at /login/mfa.
+// @Tags Auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from /login/oidc"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /login/oidc/callback [get]
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/login/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if errCode := query.Get("error"); errCode != "" {
+		response.Unauthorized(w, "Login failed at the provider: "+errCode)
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || code == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		response.BadRequest(w, "Invalid login state")
+		return
+	}
+
+	login, err := h.store.OIDC.TakeLoginState(utils.HashToken(state))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.BadRequest(w, "Invalid login state")
+			return
+		}
+		h.log.Error("failed to get login state", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if time.Now().After(login.ExpiresAt) {
+		response.BadRequest(w, "Login expired, please start again")
+		return
+	}
+
+	claims, err := h.provider.Exchange(r.Context(), code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		h.log.Error("failed to complete oidc login", slog.Any("error", err))
+		response.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var (
+		user   *models.User
+		tokens *TokenResponse
+	)
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		user, err = h.identityUser(tx, claims)
+		if err != nil {
+			return err
+		}
+
+		if user.MFAEnabled() {
+			return nil
+		}
+
+		tokens, err = startSession(tx, h.keys, h.config, user, r)
+		return err
+	})
+
+	if errors.Is(err, errIdentityNotLinked) {
+		response.Forbidden(w, "No account is linked to this identity")
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to log in with oidc", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	// The provider vouches for the password, not for the second factor this
+	// user set up here.
+	if user.MFAEnabled() {
+		token, err := utils.SignActionToken(user.ID, mfaLoginAction, h.config.Auth.MFAChallengeTTL, h.config.JWT.Secret)
+		if err != nil {
+			h.log.Error("failed to sign mfa challenge", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+
+		response.OK(w, MFAChallengeResponse{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	response.OK(w, tokens)
+}
+
+// identityUser returns the user linked to the identity in claims. An
+// unknown identity is linked to the user with the same email address if
+// both sides have verified it, or else to a new user.
+func (h *OIDCHandler) identityUser(tx *storage.Storage, claims *oidc.Claims) (*models.User, error) {
+	issuer := h.config.OIDC.Issuer
+	email := strings.ToLower(claims.Email)
+
+	// A concurrent first login of the same identity waits here until the
+	// other has linked it, and then finds it.
+	if err := tx.OIDC.LockIdentity(issuer, claims.Subject); err != nil {
+		return nil, err
+	}
+
+	identity, err := tx.OIDC.GetIdentity(issuer, claims.Subject)
+	if err == nil {
+		if err := tx.OIDC.TouchIdentity(identity, email); err != nil {
+			return nil, err
+		}
+		return tx.Users.GetUser(identity.UserID)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var user *models.User
+	if email != "" {
+		existing, err := tx.Users.GetUserByEmail(email)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		if err == nil {
+			// Linking on an address only one side has verified would let
+			// anyone who claims it take over the account.
+			if claims.EmailVerified && existing.VerifiedEmail() == email {
+				user = existing
+			}
+			// The address belongs to someone else, so a new user goes
+			// without it.
+			email = ""
+		}
+	}
+
+	if user == nil {
+		if !h.config.OIDC.AutoProvision {
+			return nil, errIdentityNotLinked
+		}
+
+		if user, err = provisionUser(tx, h.passwords, claims, email); err != nil {
+			return nil, err
+		}
+	}
+
+	identity, created, err := tx.OIDC.CreateIdentity(&models.ExternalIdentity{
+		UserID:      user.ID,
+		Issuer:      issuer,
+		Subject:     claims.Subject,
+		Email:       strings.ToLower(claims.Email),
+		LastLoginAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return tx.Users.GetUser(identity.UserID)
+	}
+
+	return user, nil
+}
+
+// provisionUser creates a user for an identity on its first login. The user
+// gets a random password, so it can only log in through the provider until
+// it resets the password.
+func provisionUser(tx *storage.Storage, passwords *auth.Passwords, claims *oidc.Claims, email string) (*models.User, error) {
+	username, err := freeUsername(tx, usernameBase(claims))
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := utils.RandomToken(oidcStateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username: username,
+		Password: hashed,
+	}
+	if email != "" {
+		user.Email = &email
+		if claims.EmailVerified {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	if err := tx.Users.CreateUser(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// usernameBase picks the username the provider suggests, falling back to
+// the local part of the email address. Either is made to follow the rules
+// of /register, leaving room for the suffix freeUsername may add.
+func usernameBase(claims *oidc.Claims) string {
+	maxLength := utils.MaxUsernameLength - usernameSuffixLength
+	for _, name := range []string{claims.PreferredUsername, localPart(claims.Email)} {
+		if username := utils.SanitizeUsername(name, maxLength); username != "" {
+			return username
+		}
+	}
+	return "user"
+}
+
+func localPart(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
+
+// freeUsername returns base if no user has it, or base with a random suffix.
+// Taken names are looked up rather than caught on insert, because a failed
+// insert aborts the transaction.
+func freeUsername(tx *storage.Storage, base string) (string, error) {
+	username := base
+	for range maxUsernameAttempts {
+		_, err := tx.Users.GetUserByUsername(username)
+		if err == gorm.ErrRecordNotFound {
+			return username, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		suffix, err := utils.RandomToken(3)
+		if err != nil {
+			return "", err
+		}
+		username = base + "-" + strings.ToLower(suffix)
+	}
+
+	return "", errors.New("no free username for " + base)
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const passwordResetTokenBytes = 32
+
+var errInvalidResetToken = errors.New("password reset token is expired or used")
+
+type PasswordHandler struct {
+	store     *storage.Storage
+	denylist  *auth.Denylist
+	passwords *auth.Passwords
+	notifier  notify.Notifier
+	validate  *validator.Validate
+	config    *config.Config
+	log       *slog.Logger
+}
+
+func NewPasswordHandler(store *storage.Storage, denylist *auth.Denylist, passwords *auth.Passwords, notifier notify.Notifier, validator *validator.Validate, config *config.Config, logger *slog.Logger) *PasswordHandler {
+	return &PasswordHandler{
+		store:     store,
+		denylist:  denylist,
+		passwords: passwords,
+		notifier:  notifier,
+		validate:  validator,
+		config:    config,
+		log:       logger,
+	}
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	// NewPassword must satisfy the password policy.
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// @Summary Change password
+// @Description Change the password of the current user. Every other session is signed out.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param password body ChangePasswordRequest true "Current and new password"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/password [put]
+// @Security ApiKeyAuth
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	claims := middleware.GetAuthClaimsFromContext(r.Context())
+	var payload ChangePasswordRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if _, err := h.passwords.Verify(user.Password, payload.CurrentPassword); err != nil {
+		if !errors.Is(err, auth.ErrPasswordMismatch) {
+			h.log.Error("failed to verify password", slog.Any("error", err))
+		}
+		response.BadRequest(w, "Current password is incorrect")
+		return
+	}
+
+	if err := h.passwords.Check(payload.NewPassword, user.Username); err != nil {
+		writePasswordCheckError(w, err, h.log)
+		return
+	}
+
+	hashed, err := h.passwords.Hash(payload.NewPassword)
+	if err != nil {
+		h.log.Error("failed to hash password", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if err := tx.Users.UpdateUser(user, map[string]any{"password": hashed}); err != nil {
+			return err
+		}
+
+		return tx.PasswordReset.InvalidatePasswordResetTokens(user.ID)
+	})
+	if err != nil {
+		h.log.Error("failed to change password", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	sessions, err := h.store.Sessions.GetActiveSessions(user.ID, time.Time{})
+	if err != nil {
+		h.log.Error("failed to get sessions", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	for i := range sessions {
+		if sessions[i].ID == claims.SessionID {
+			continue
+		}
+		if err := revokeSession(h.store, h.denylist, h.config, &sessions[i]); err != nil {
+			h.log.Error("failed to revoke session", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	response.NoContent(w)
+}
+
+// ForgotPasswordRequest identifies the account by username or by email
+// address.
+type ForgotPasswordRequest struct {
+	Username string `json:"username" validate:"required_without=Email"`
+	Email    string `json:"email" validate:"omitempty,email"`
+}
+
+// @Summary Request a password reset
+// @Description Send a password reset link to the account, if it exists. The response is the same either way.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param user body ForgotPasswordRequest true "Account"
+// @Success 202 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Router /password/forgot [post]
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	// The lookup and delivery happen after responding, so that neither the
+	// response nor its timing tells whether the account exists.
+	go h.sendPasswordReset(context.WithoutCancel(r.Context()), payload)
+
+	response.WriteResponse(w, http.StatusAccepted, nil, "If the account exists, a password reset link has been sent", true)
+}
+
+func (h *PasswordHandler) sendPasswordReset(ctx context.Context, payload ForgotPasswordRequest) {
+	var (
+		user *models.User
+		err  error
+	)
+	if payload.Email != "" {
+		user, err = h.store.Users.GetUserByEmail(strings.ToLower(payload.Email))
+	} else {
+		user, err = h.store.Users.GetUserByUsername(payload.Username)
+	}
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			h.log.Error("failed to get user", slog.Any("error", err))
+		}
+		return
+	}
+
+	token, err := utils.RandomToken(passwordResetTokenBytes)
+	if err != nil {
+		h.log.Error("failed to generate password reset token", slog.Any("error", err))
+		return
+	}
+
+	expiresAt := time.Now().Add(h.config.Auth.PasswordResetTTL)
+	err = h.store.PasswordReset.CreatePasswordResetToken(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		h.log.Error("failed to create password reset token", slog.Any("error", err))
+		return
+	}
+
+	err = h.notifier.Notify(ctx, notify.Message{
+		UserID:  user.ID,
+		To:      user.VerifiedEmail(),
+		Kind:    notify.KindPasswordReset,
+		Subject: "Reset your Task Master password",
+		Body:    "Use the link in this message to choose a new password.",
+		Data: map[string]any{
+			"Username":  user.Username,
+			"ResetURL":  h.config.HttpServer.PublicURL + "/password/reset?token=" + url.QueryEscape(token),
+			"ExpiresAt": expiresAt,
+		},
+	})
+	if err != nil {
+		h.log.Error("failed to send password reset", slog.Any("error", err))
+	}
+}
+
+type ResetPasswordRequest struct {
+	Token string `json:"token" validate:"required"`
+	// NewPassword must satisfy the password policy.
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// @Summary Password reset page
+// @Description The page the password reset link in emails opens, with a form for the new password that is posted to /password/reset.
+// @Tags Auth
+// @Produce html
+// @Param token query string true "Reset token from the email"
+// @Success 200
+// @Router /password/reset [get]
+func (h *PasswordHandler) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, http.StatusOK, resetPasswordPage(r.URL.Query().Get("token"), ""), h.log)
+}
+
+func resetPasswordPage(token, message string) linkPage {
+	return linkPage{
+		Title:       "Choose a new password",
+		Error:       message,
+		Action:      "/password/reset",
+		Token:       token,
+		Button:      "Set password",
+		NewPassword: true,
+	}
+}
+
+// @Summary Reset password
+// @Description Set a new password with the token from a password reset link. The token works once, and every session of the account is signed out. The reset page posts a form instead of JSON and gets a page back.
+// @Tags Auth
+// @Accept json
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param password body ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /password/reset [post]
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		h.resetPasswordForm(w, r)
+		return
+	}
+
+	var payload ResetPasswordRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	err := h.resetPassword(payload.Token, payload.NewPassword)
+	if errors.Is(err, errInvalidResetToken) {
+		response.BadRequest(w, "Invalid or expired reset token")
+		return
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		response.BadRequest(w, policyErr.Error())
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to reset password", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// resetPasswordForm handles the form of the reset page.
+func (h *PasswordHandler) resetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	token, password := r.PostFormValue("token"), r.PostFormValue("new_password")
+	if password == "" || password != r.PostFormValue("confirm_password") {
+		renderLinkPage(w, http.StatusBadRequest, resetPasswordPage(token, "The passwords do not match."), h.log)
+		return
+	}
+
+	err := h.resetPassword(token, password)
+	if errors.Is(err, errInvalidResetToken) {
+		renderLinkPage(w, http.StatusBadRequest, linkPage{
+			Title: "Choose a new password",
+			Error: "This reset link is invalid or has expired. Request a new one.",
+		}, h.log)
+		return
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		renderLinkPage(w, http.StatusBadRequest, resetPasswordPage(token, policyErr.Error()+"."), h.log)
+		return
+	}
+
+	if err != nil {
+		h.log.Error("failed to reset password", slog.Any("error", err))
+		renderLinkPage(w, http.StatusInternalServerError, resetPasswordPage(token, "Something went wrong, please try again later."), h.log)
+		return
+	}
+
+	renderLinkPage(w, http.StatusOK, linkPage{
+		Title:   "Password changed",
+		Message: "Your password has been changed and every device has been signed out. Log in with the new password.",
+	}, h.log)
+}
+
+// resetPassword sets password as the password of the user the reset token
+// was issued to. It returns errInvalidResetToken if the token is unknown,
+// used or expired, and a *auth.PasswordPolicyError if the password is not
+// allowed.
+func (h *PasswordHandler) resetPassword(resetToken, password string) error {
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		token, err := tx.PasswordReset.GetPasswordResetTokenForUpdate(utils.HashToken(resetToken))
+		if err != nil {
+			return err
+		}
+
+		if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+			return errInvalidResetToken
+		}
+
+		user, err := tx.Users.GetUser(token.UserID)
+		if err != nil {
+			return err
+		}
+
+		if err := h.passwords.Check(password, user.Username); err != nil {
+			return err
+		}
+
+		hashed, err := h.passwords.Hash(password)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Users.UpdateUser(user, map[string]any{"password": hashed}); err != nil {
+			return err
+		}
+
+		if err := tx.PasswordReset.InvalidatePasswordResetTokens(user.ID); err != nil {
+			return err
+		}
+
+		return revokeAllSessions(tx, user)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvalidResetToken
+	}
+	return err
+}
+
+// writePasswordCheckError answers a new password that failed
+// Passwords.Check: with the reason if the policy refused it, or with 500 if
+// the check itself failed.
+func writePasswordCheckError(w http.ResponseWriter, err error, logger *slog.Logger) {
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		response.BadRequest(w, policyErr.Error())
+		return
+	}
+
+	logger.Error("failed to check password", slog.Any("error", err))
+	response.InternalServerError(w)
+}
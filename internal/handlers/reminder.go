@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+type ReminderHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewReminderHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *ReminderHandler {
+	return &ReminderHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+type CreateReminderRequest struct {
+	// RemindAt is an absolute reminder time.
+	RemindAt *time.Time `json:"remind_at" validate:"required_without=OffsetMinutes,excluded_with=OffsetMinutes"`
+	// OffsetMinutes fires the reminder this many minutes before the task is due.
+	OffsetMinutes *int `json:"offset_minutes" validate:"omitempty,min=0"`
+}
+
+// @Summary Create a reminder for a task
+// @Description Create a reminder at an absolute time, or relative to the task's due date
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param reminder body CreateReminderRequest true "Reminder details"
+// @Success 201 {object} models.Reminder
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /tasks/{id}/reminders [post]
+// @Security ApiKeyAuth
+func (h *ReminderHandler) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	task := middleware.GetTaskFromContext(r.Context())
+	var payload CreateReminderRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	reminder := models.Reminder{
+		TaskID:        task.ID,
+		UserID:        task.UserID,
+		RemindAt:      payload.RemindAt,
+		OffsetMinutes: payload.OffsetMinutes,
+	}
+	reminder.ResolveFireAt(task.DueAt)
+
+	if err := h.store.Reminders.CreateReminder(&reminder); err != nil {
+		h.log.Error("failed to create reminder", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, reminder)
+}
+
+// @Summary Get all reminders for a task
+// @Description Get all reminders for a task
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} []models.Reminder
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /tasks/{id}/reminders [get]
+// @Security ApiKeyAuth
+func (h *ReminderHandler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	task := middleware.GetTaskFromContext(r.Context())
+
+	reminders, err := h.store.Reminders.GetReminders(task.ID)
+
+	if err != nil {
+		h.log.Error("failed to get reminders", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, reminders)
+}
+
+// @Summary Delete a reminder
+// @Description Delete a reminder
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param reminderID path int true "Reminder ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /tasks/{id}/reminders/{reminderID} [delete]
+// @Security ApiKeyAuth
+func (h *ReminderHandler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	task := middleware.GetTaskFromContext(r.Context())
+	reminderID, err := strconv.Atoi(chi.URLParam(r, "reminderID"))
+	if err != nil || reminderID < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	reminder, err := h.store.Reminders.GetReminder(uint(reminderID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFound(w, "Reminder not found")
+			return
+		}
+		h.log.Error("failed to get reminder", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if reminder.TaskID != task.ID {
+		response.NotFound(w, "Reminder not found")
+		return
+	}
+
+	if err := h.store.Reminders.DeleteReminder(reminder.ID); err != nil {
+		h.log.Error("failed to delete reminder", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"gorm.io/gorm"
+)
+
+type SessionHandler struct {
+	store    *storage.Storage
+	denylist *auth.Denylist
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewSessionHandler(store *storage.Storage, denylist *auth.Denylist, config *config.Config, logger *slog.Logger) *SessionHandler {
+	return &SessionHandler{
+		store:    store,
+		denylist: denylist,
+		config:   config,
+		log:      logger,
+	}
+}
+
+// @Summary List active sessions
+// @Description List the devices the user is signed in on, most recently seen first. last_seen_at is updated whenever the device refreshes its tokens.
+// @Tags User
+// @Produce json
+// @Success 200 {object} []models.Session
+// @Failure 500 {object} response.Response
+// @Router /user/sessions [get]
+// @Security ApiKeyAuth
+func (h *SessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	claims := middleware.GetAuthClaimsFromContext(r.Context())
+
+	sessions, err := h.store.Sessions.GetActiveSessions(user.ID, time.Now().Add(-h.config.JWT.RefreshTokenTTL))
+	if err != nil {
+		h.log.Error("failed to get sessions", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	response.OK(w, sessions)
+}
+
+// @Summary Revoke a session
+// @Description Sign a device out. Its refresh token stops working immediately and its access token shortly after.
+// @Tags User
+// @Param id path int true "Session ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/sessions/{id} [delete]
+// @Security ApiKeyAuth
+func (h *SessionHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || sessionID < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	session, err := h.store.Sessions.GetSession(uint(sessionID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFound(w, "Session not found")
+			return
+		}
+		h.log.Error("failed to get session", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if session.UserID != user.ID || session.RevokedAt != nil {
+		response.NotFound(w, "Session not found")
+		return
+	}
+
+	if err := revokeSession(h.store, h.denylist, h.config, session); err != nil {
+		h.log.Error("failed to revoke session", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
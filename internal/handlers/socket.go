@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/events"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"golang.org/x/net/websocket"
+)
+
+const socketPingInterval = 30 * time.Second
+
+// SocketHandler serves a two-way WebSocket API. Clients subscribe to
+// topics to receive task changes, and send requests that are dispatched to
+// the REST router with the connection's credentials, so they go through the
+// same middleware, handlers and validation as plain HTTP calls.
+type SocketHandler struct {
+	router http.Handler
+	// origins are the lower-case origins browsers may connect from.
+	origins      map[string]bool
+	store        *storage.Storage
+	broker       *events.Broker
+	authenticate middleware.Authenticator
+	config       *config.Config
+	log          *slog.Logger
+}
+
+func NewSocketHandler(router http.Handler, store *storage.Storage, broker *events.Broker, authenticate middleware.Authenticator, config *config.Config, logger *slog.Logger) *SocketHandler {
+	origins := map[string]bool{}
+	for _, origin := range append([]string{config.HttpServer.PublicURL}, config.HttpServer.AllowedOrigins...) {
+		if u, err := url.Parse(strings.TrimSpace(origin)); err == nil && u.Host != "" {
+			origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+		}
+	}
+
+	return &SocketHandler{
+		router:       router,
+		origins:      origins,
+		store:        store,
+		broker:       broker,
+		authenticate: authenticate,
+		config:       config,
+		log:          logger,
+	}
+}
+
+// SocketMessage is sent by clients. Type is "subscribe", "unsubscribe",
+// "request" or "auth". Topics are "tasks" for every task of the user and
+// "task:<id>" for a single task. Requests are limited to paths under /tasks.
+// "auth" replaces the connection's token with Token, a fresh access token
+// of the same user, before the old one expires.
+type SocketMessage struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Topic  string          `json:"topic,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Path   string          `json:"path,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// IfMatch is sent as the If-Match header of the request.
+	IfMatch string `json:"if_match,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// SocketReply is sent by the server. Type is "ack", "error", "response",
+// "event" or "ping". Events carry the same payload as webhooks, including
+// the changed fields of updates. When the token expires or is revoked the
+// server sends an "error" of "unauthorized" and closes the connection.
+type SocketReply struct {
+	ID      string            `json:"id,omitempty"`
+	Type    string            `json:"type"`
+	Topic   string            `json:"topic,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	EventID uint64            `json:"event_id,omitempty"`
+	Event   string            `json:"event,omitempty"`
+	Payload json.RawMessage   `json:"payload,omitempty"`
+}
+
+// @Summary Live updates over WebSocket
+// @Description Upgrade to a WebSocket. Authenticate with the Authorization header or the access_token query parameter. Send {"type":"subscribe","topic":"tasks"} or "task:<id>" to receive changes, and {"id":"1","type":"request","method":"PATCH","path":"/tasks/1","body":{...}} to mutate tasks. Send {"type":"auth","token":"..."} with a fresh access token before the current one expires; the connection is closed when its token expires or is revoked.
+// @Tags Event
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 101
+// @Failure 401 {object} response.Response
+// @Router /ws [get]
+// @Security ApiKeyAuth
+func (h *SocketHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	credentials := newStreamCredentials(h.authenticate, r)
+
+	server := websocket.Server{
+		Handshake: h.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			conn := &socketConn{
+				ws:          ws,
+				handler:     h,
+				user:        user,
+				credentials: credentials,
+				topics:      map[string]bool{},
+			}
+			conn.run(r.Context())
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// checkOrigin rejects connections from web pages on origins other than
+// PUBLIC_URL and ALLOWED_ORIGINS. Clients outside browsers send no Origin
+// and are let through.
+func (h *SocketHandler) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	if !h.origins[strings.ToLower(origin)] {
+		return errors.New("origin not allowed: " + origin)
+	}
+	return nil
+}
+
+type socketConn struct {
+	ws          *websocket.Conn
+	handler     *SocketHandler
+	user        *models.User
+	credentials *streamCredentials
+
+	writeMu sync.Mutex
+
+	topicsMu sync.Mutex
+	topics   map[string]bool
+}
+
+func (c *socketConn) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer c.ws.Close()
+
+	live, unsubscribe := c.handler.broker.Subscribe(c.user.ID)
+	defer unsubscribe()
+
+	go c.pushEvents(ctx, cancel, live)
+
+	for {
+		var msg SocketMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			return
+		}
+
+		switch msg.Type {
+		case "subscribe", "unsubscribe":
+			if !validTopic(msg.Topic) {
+				c.send(SocketReply{ID: msg.ID, Type: "error", Error: "unknown topic"})
+				continue
+			}
+			c.topicsMu.Lock()
+			if msg.Type == "subscribe" {
+				c.topics[msg.Topic] = true
+			} else {
+				delete(c.topics, msg.Topic)
+			}
+			c.topicsMu.Unlock()
+			c.send(SocketReply{ID: msg.ID, Type: "ack", Topic: msg.Topic})
+		case "request":
+			if !c.authorized() {
+				return
+			}
+			c.send(c.dispatch(ctx, msg))
+		case "auth":
+			if err := c.credentials.Replace("Bearer " + msg.Token); err != nil {
+				if !errors.Is(err, middleware.ErrUnauthorized) && !errors.Is(err, errStreamUserChanged) {
+					c.handler.log.Error("failed to check socket token", slog.Any("error", err))
+				}
+				c.send(SocketReply{ID: msg.ID, Type: "error", Error: "invalid token"})
+				continue
+			}
+			c.send(SocketReply{ID: msg.ID, Type: "ack"})
+		default:
+			c.send(SocketReply{ID: msg.ID, Type: "error", Error: "unknown message type"})
+		}
+	}
+}
+
+// authorized checks the connection's token, and closes the connection if
+// it has expired or been revoked.
+func (c *socketConn) authorized() bool {
+	err := c.credentials.Check()
+	if err == nil {
+		return true
+	}
+
+	if !errors.Is(err, middleware.ErrUnauthorized) {
+		c.handler.log.Error("failed to check socket token", slog.Any("error", err))
+	}
+	c.send(SocketReply{Type: "error", Error: "unauthorized"})
+	c.ws.Close()
+	return false
+}
+
+// pushEvents forwards the user's events for subscribed topics until ctx is
+// done. When the broker drops the subscription or the token is no longer
+// valid the connection is closed, so the client reconnects and refetches.
+func (c *socketConn) pushEvents(ctx context.Context, cancel context.CancelFunc, live <-chan models.Event) {
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+
+	recheck := time.NewTimer(c.credentials.NextCheck())
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			c.send(SocketReply{Type: "ping"})
+		case <-recheck.C:
+			if !c.authorized() {
+				cancel()
+				return
+			}
+			recheck.Reset(c.credentials.NextCheck())
+		case event, ok := <-live:
+			if !ok {
+				cancel()
+				c.ws.Close()
+				return
+			}
+
+			topic := c.matchTopic(event)
+			if topic == "" {
+				continue
+			}
+
+			c.send(SocketReply{
+				Type:    "event",
+				Topic:   topic,
+				EventID: event.ID,
+				Event:   event.Type,
+				Payload: json.RawMessage(event.Payload),
+			})
+		}
+	}
+}
+
+func (c *socketConn) matchTopic(event models.Event) string {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	if c.topics["tasks"] {
+		return "tasks"
+	}
+
+	var payload struct {
+		Data struct {
+			ID uint `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		return ""
+	}
+
+	if topic := "task:" + strconv.FormatUint(uint64(payload.Data.ID), 10); c.topics[topic] {
+		return topic
+	}
+
+	return ""
+}
+
+// dispatch runs a request through the REST router as the connected user.
+func (c *socketConn) dispatch(ctx context.Context, msg SocketMessage) SocketReply {
+	method := strings.ToUpper(msg.Method)
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete:
+	default:
+		return SocketReply{ID: msg.ID, Type: "error", Error: "unsupported method"}
+	}
+
+	if msg.Path != "/tasks" && !strings.HasPrefix(msg.Path, "/tasks/") {
+		return SocketReply{ID: msg.ID, Type: "error", Error: "unsupported path"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, msg.Path, bytes.NewReader(msg.Body))
+	if err != nil {
+		return SocketReply{ID: msg.ID, Type: "error", Error: "invalid request"}
+	}
+	req.Header.Set("Authorization", c.credentials.Authorization())
+	req.Header.Set("Content-Type", "application/json")
+	if msg.IfMatch != "" {
+		req.Header.Set("If-Match", msg.IfMatch)
+	}
+
+	rec := newResponseRecorder()
+	c.handler.router.ServeHTTP(rec, req)
+
+	reply := SocketReply{ID: msg.ID, Type: "response", Status: rec.status}
+	for _, name := range socketReplyHeaders {
+		if value := rec.header.Get(name); value != "" {
+			if reply.Headers == nil {
+				reply.Headers = map[string]string{}
+			}
+			reply.Headers[name] = value
+		}
+	}
+	if body := bytes.TrimSpace(rec.body.Bytes()); len(body) > 0 {
+		reply.Body = json.RawMessage(body)
+	}
+	return reply
+}
+
+func (c *socketConn) send(reply SocketReply) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := websocket.JSON.Send(c.ws, reply); err != nil {
+		c.ws.Close()
+	}
+}
+
+func validTopic(topic string) bool {
+	if topic == "tasks" {
+		return true
+	}
+
+	id, ok := strings.CutPrefix(topic, "task:")
+	if !ok {
+		return false
+	}
+
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// socketReplyHeaders are the response headers passed on to socket clients.
+var socketReplyHeaders = []string{
+	"ETag",
+	"Location",
+	"Retry-After",
+	"RateLimit-Policy",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"Idempotent-Replayed",
+}
+
+// responseRecorder captures a response produced by the router for a
+// request dispatched over a WebSocket.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
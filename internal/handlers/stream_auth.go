@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/middleware"
+)
+
+// streamAuthInterval is how often long-lived streams check that the token
+// they run on has not been revoked. Expiry is checked on time.
+const streamAuthInterval = 30 * time.Second
+
+var errStreamUserChanged = errors.New("token belongs to another user")
+
+// streamCredentials is the token a stream was opened with, checked again
+// for as long as the stream stays open. Sockets may swap it for a fresh
+// token before it expires.
+type streamCredentials struct {
+	authenticate middleware.Authenticator
+	userID       uint
+
+	mu            sync.Mutex
+	authorization string
+	expiresAt     time.Time
+}
+
+// newStreamCredentials takes the credentials of a request that Auth has
+// accepted.
+func newStreamCredentials(authenticate middleware.Authenticator, r *http.Request) *streamCredentials {
+	c := &streamCredentials{
+		authenticate:  authenticate,
+		userID:        middleware.GetAuthUserFromContext(r.Context()).ID,
+		authorization: r.Header.Get("Authorization"),
+	}
+	if claims := middleware.GetAuthClaimsFromContext(r.Context()); claims.ExpiresAt != nil {
+		c.expiresAt = claims.ExpiresAt.Time
+	}
+	return c
+}
+
+// Authorization returns the header requests on behalf of the stream are
+// made with.
+func (c *streamCredentials) Authorization() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authorization
+}
+
+// Check returns an error once the token has expired, or has been revoked by
+// logging out, ending its session or logging out everywhere.
+func (c *streamCredentials) Check() error {
+	c.mu.Lock()
+	authorization, expiresAt := c.authorization, c.expiresAt
+	c.mu.Unlock()
+
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return middleware.ErrUnauthorized
+	}
+
+	_, _, err := c.authenticate(authorization)
+	return err
+}
+
+// Replace switches to a fresh token of the same user.
+func (c *streamCredentials) Replace(authorization string) error {
+	user, claims, err := c.authenticate(authorization)
+	if err != nil {
+		return err
+	}
+
+	if user.ID != c.userID {
+		return errStreamUserChanged
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.authorization = authorization
+	c.expiresAt = time.Time{}
+	if claims.ExpiresAt != nil {
+		c.expiresAt = claims.ExpiresAt.Time
+	}
+	return nil
+}
+
+// NextCheck returns how long to wait before calling Check again.
+func (c *streamCredentials) NextCheck() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wait := streamAuthInterval
+	if !c.expiresAt.IsZero() {
+		wait = min(wait, time.Until(c.expiresAt))
+	}
+	return max(wait, 0)
+}
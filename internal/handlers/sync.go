@@ -0,0 +1,563 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
+)
+
+const syncPageSize = 500
+
+const (
+	syncStrategyLWW   = "lww"
+	syncStrategyMerge = "merge"
+
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncRejected = "rejected"
+	syncFailed   = "failed"
+)
+
+// syncFieldRules lists the task fields clients may change through sync,
+// with the validation applied to each.
+var syncFieldRules = map[string]string{
+	"title":      "required",
+	"body":       "",
+	"completed":  "",
+	"due_at":     "",
+	"priority":   "omitempty,oneof=low medium high urgent",
+	"recurrence": "omitempty,oneof=daily weekly monthly yearly",
+	"tags":       "dive,required",
+	"checklist":  "dive",
+}
+
+type SyncHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewSyncHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *SyncHandler {
+	return &SyncHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+type SyncResponse struct {
+	Tasks   []models.Task          `json:"tasks"`
+	Deleted []models.TaskTombstone `json:"deleted"`
+	// Tags is the full set of tags in use, since tags only exist on tasks.
+	Tags []string `json:"tags"`
+	// SyncToken is passed as since on the next call.
+	SyncToken string `json:"sync_token"`
+	// HasMore means more changes are waiting; call again with SyncToken.
+	HasMore bool `json:"has_more"`
+}
+
+// @Summary Fetch changes since a sync token
+// @Description Return tasks changed and deleted after the given sync token, oldest first, along with a new token. Omit since for a full sync. Deleted tasks are only reported for incremental syncs.
+// @Tags Sync
+// @Produce json
+// @Param since query string false "Sync token from the previous call"
+// @Success 200 {object} SyncResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /sync [get]
+// @Security ApiKeyAuth
+func (h *SyncHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			response.BadRequest(w, "Invalid sync token")
+			return
+		}
+	}
+
+	tasks, err := h.store.Tasks.GetTasksChangedSince(user.ID, since, syncPageSize+1)
+	if err != nil {
+		h.log.Error("failed to get changed tasks", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	var tombstones []models.TaskTombstone
+	if since > 0 {
+		if tombstones, err = h.store.Tasks.GetTombstonesSince(user.ID, since, syncPageSize+1); err != nil {
+			h.log.Error("failed to get tombstones", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	tags, err := h.store.Tasks.GetTags(user.ID)
+	if err != nil {
+		h.log.Error("failed to get tags", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	res := SyncResponse{
+		Tasks:   []models.Task{},
+		Deleted: []models.TaskTombstone{},
+		Tags:    tags,
+	}
+
+	// Merge both lists in version order, so the token never skips a change.
+	token := since
+	i, j := 0, 0
+	for n := 0; n < syncPageSize && (i < len(tasks) || j < len(tombstones)); n++ {
+		if j >= len(tombstones) || (i < len(tasks) && tasks[i].SyncVersion < tombstones[j].SyncVersion) {
+			res.Tasks = append(res.Tasks, tasks[i])
+			token = tasks[i].SyncVersion
+			i++
+		} else {
+			res.Deleted = append(res.Deleted, tombstones[j])
+			token = tombstones[j].SyncVersion
+			j++
+		}
+	}
+
+	res.HasMore = i < len(tasks) || j < len(tombstones)
+	res.SyncToken = strconv.FormatUint(token, 10)
+
+	response.OK(w, res)
+}
+
+type SyncChange struct {
+	// ClientID identifies the change in the response.
+	ClientID string `json:"client_id" validate:"required"`
+	Op       string `json:"op" validate:"required,oneof=create update delete"`
+	// ID is the server ID of the task to update or delete.
+	ID uint `json:"id" validate:"required_unless=Op create"`
+	// ParentID or ParentClientID, the client_id of an earlier create in the
+	// same batch, make a created task a subtask.
+	ParentID       *uint  `json:"parent_id"`
+	ParentClientID string `json:"parent_client_id"`
+	// BaseVersion is the sync_version of the task the change was made to.
+	BaseVersion uint64 `json:"base_version"`
+	// ModifiedAt is when the change was made on the client, used by
+	// last-writer-wins. It defaults to now.
+	ModifiedAt *time.Time `json:"modified_at"`
+	// Fields holds the new values of changed fields.
+	Fields map[string]json.RawMessage `json:"fields" swaggertype:"object"`
+	// Base holds the values of the changed fields before the change, used
+	// by field-level merge.
+	Base map[string]json.RawMessage `json:"base" swaggertype:"object"`
+}
+
+type PushSyncRequest struct {
+	// Strategy resolves changes to tasks modified on the server since
+	// BaseVersion. "lww" keeps whichever side was modified last; "merge"
+	// applies the fields the server has not changed and reports the rest.
+	Strategy string       `json:"strategy" validate:"omitempty,oneof=lww merge"`
+	Changes  []SyncChange `json:"changes" validate:"required,max=500,dive"`
+}
+
+type SyncResult struct {
+	ClientID string `json:"client_id"`
+	ID       uint   `json:"id,omitempty"`
+	// Status is "applied", "conflict", "rejected" or "failed".
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Task   *models.Task `json:"task,omitempty"`
+}
+
+type SyncConflict struct {
+	ClientID string `json:"client_id"`
+	ID       uint   `json:"id"`
+	// Reason is "modified" when the task changed on the server or
+	// "deleted" when it no longer exists.
+	Reason string `json:"reason"`
+	// Fields lists the fields that were not applied.
+	Fields []string `json:"fields,omitempty"`
+	// Server is the current server copy of the task.
+	Server *models.Task `json:"server,omitempty"`
+}
+
+type PushSyncResponse struct {
+	Results   []SyncResult   `json:"results"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// @Summary Push client changes
+// @Description Apply a batch of task changes made offline, in order. Each change is applied on its own; changes to tasks modified on the server since base_version are resolved with the chosen strategy and reported in conflicts.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param changes body PushSyncRequest true "Client changes"
+// @Success 200 {object} PushSyncResponse
+// @Failure 400 {object} response.Response
+// @Router /sync [post]
+// @Security ApiKeyAuth
+func (h *SyncHandler) PushChanges(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload PushSyncRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	strategy := payload.Strategy
+	if strategy == "" {
+		strategy = syncStrategyLWW
+	}
+
+	res := PushSyncResponse{
+		Results:   make([]SyncResult, 0, len(payload.Changes)),
+		Conflicts: []SyncConflict{},
+	}
+	created := map[string]uint{}
+
+	for _, change := range payload.Changes {
+		var (
+			result   SyncResult
+			conflict *SyncConflict
+			err      error
+		)
+
+		switch change.Op {
+		case "create":
+			result, err = h.createTask(user, change, created)
+		default:
+			result, conflict, err = h.changeTask(user, strategy, change)
+		}
+
+		if err != nil {
+			h.log.Error("failed to apply sync change", slog.Any("error", err))
+			result = SyncResult{ClientID: change.ClientID, ID: change.ID, Status: syncFailed, Error: "Internal Server Error"}
+		}
+
+		res.Results = append(res.Results, result)
+		if conflict != nil {
+			res.Conflicts = append(res.Conflicts, *conflict)
+		}
+	}
+
+	response.OK(w, res)
+}
+
+func (h *SyncHandler) createTask(user *models.User, change SyncChange, created map[string]uint) (SyncResult, error) {
+	rejected := func(msg string) (SyncResult, error) {
+		return SyncResult{ClientID: change.ClientID, Status: syncRejected, Error: msg}, nil
+	}
+
+	values, err := h.decodeFields(change.Fields)
+	if err != nil {
+		return rejected(err.Error())
+	}
+
+	if _, ok := values["title"]; !ok {
+		return rejected("title is required")
+	}
+
+	task := models.Task{UserID: user.ID, ParentID: change.ParentID}
+
+	if change.ParentClientID != "" {
+		parentID, ok := created[change.ParentClientID]
+		if !ok {
+			return rejected("parent_client_id does not refer to a created task")
+		}
+		task.ParentID = &parentID
+	}
+
+	if task.ParentID != nil {
+		parent, err := h.store.Tasks.GetTask(*task.ParentID)
+		if err != nil || parent.UserID != user.ID {
+			return rejected("Parent task not found")
+		}
+	}
+
+	for name, value := range values {
+		setTaskField(&task, name, value)
+	}
+	if task.Completed {
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if _, err := tx.Tasks.CreateTask(&task); err != nil {
+			return err
+		}
+
+		return publishTaskEvent(tx, models.EventTaskCreated, &task, nil)
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	created[change.ClientID] = task.ID
+
+	return SyncResult{ClientID: change.ClientID, ID: task.ID, Status: syncApplied, Task: &task}, nil
+}
+
+// changeTask applies an update or delete. The task row stays locked from
+// the conflict check until the change is committed.
+func (h *SyncHandler) changeTask(user *models.User, strategy string, change SyncChange) (SyncResult, *SyncConflict, error) {
+	result := SyncResult{ClientID: change.ClientID, ID: change.ID}
+
+	var values map[string]any
+	if change.Op == "update" {
+		var err error
+		if values, err = h.decodeFields(change.Fields); err != nil {
+			result.Status = syncRejected
+			result.Error = err.Error()
+			return result, nil, nil
+		}
+	}
+
+	var conflict *SyncConflict
+
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		task, err := tx.Tasks.GetTaskForUpdate(change.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && task.UserID != user.ID) {
+			if change.Op == "delete" {
+				result.Status = syncApplied
+				return nil
+			}
+			result.Status = syncConflict
+			conflict = &SyncConflict{ClientID: change.ClientID, ID: change.ID, Reason: "deleted"}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Changes to a task nobody else touched since the client saw it
+		// apply as they are; otherwise the strategy decides.
+		stale := task.SyncVersion > change.BaseVersion
+		clientWins := !stale || (strategy == syncStrategyLWW && !modifiedAt(change).Before(task.UpdatedAt))
+
+		if change.Op == "delete" {
+			if !clientWins {
+				result.Status = syncConflict
+				result.Task = task
+				conflict = &SyncConflict{ClientID: change.ClientID, ID: change.ID, Reason: "modified", Server: task}
+				return nil
+			}
+
+			if err := tx.Tasks.DeleteTask(task); err != nil {
+				return err
+			}
+
+			result.Status = syncApplied
+			return publishTaskEvent(tx, models.EventTaskDeleted, task, nil)
+		}
+
+		updates := map[string]any{}
+		var conflicts []string
+
+		for name, value := range values {
+			current := taskField(task, name)
+			if sameValue(current, value) {
+				continue
+			}
+
+			if !clientWins {
+				if strategy == syncStrategyLWW {
+					conflicts = append(conflicts, name)
+					continue
+				}
+
+				// Field-level merge: take the client's value only if the
+				// server still holds the value the client started from.
+				raw, ok := change.Base[name]
+				if !ok {
+					conflicts = append(conflicts, name)
+					continue
+				}
+				base, err := decodeField(name, raw)
+				if err != nil || !sameValue(current, base) {
+					conflicts = append(conflicts, name)
+					continue
+				}
+			}
+
+			if name == "completed" {
+				setCompleted(updates, value.(bool))
+			} else {
+				updates[name] = value
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := applyTaskUpdates(tx, task, updates); err != nil {
+				return err
+			}
+		}
+
+		result.Task = task
+		result.Status = syncApplied
+		if len(conflicts) > 0 {
+			result.Status = syncConflict
+			conflict = &SyncConflict{ClientID: change.ClientID, ID: change.ID, Reason: "modified", Fields: conflicts, Server: task}
+		}
+
+		return nil
+	})
+
+	return result, conflict, err
+}
+
+// decodeFields decodes and validates the fields of a change.
+func (h *SyncHandler) decodeFields(fields map[string]json.RawMessage) (map[string]any, error) {
+	values := make(map[string]any, len(fields))
+	for name, raw := range fields {
+		rule, ok := syncFieldRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+
+		value, err := decodeField(name, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q", name)
+		}
+
+		if rule != "" {
+			if err := h.validate.Var(value, rule); err != nil {
+				return nil, fmt.Errorf("invalid value for %q", name)
+			}
+		}
+
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// decodeField decodes a field value into the form stored on models.Task,
+// normalized so that equal values compare equal.
+func decodeField(name string, raw json.RawMessage) (any, error) {
+	switch name {
+	case "completed":
+		var v bool
+		return v, json.Unmarshal(raw, &v)
+	case "due_at":
+		var v *time.Time
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return normalizeTime(v), nil
+	case "tags":
+		var v []string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if len(v) == 0 {
+			return models.StringList(nil), nil
+		}
+		return models.StringList(v), nil
+	case "checklist":
+		var v []models.ChecklistItem
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if len(v) == 0 {
+			return models.Checklist(nil), nil
+		}
+		return models.Checklist(v), nil
+	default:
+		var v string
+		return v, json.Unmarshal(raw, &v)
+	}
+}
+
+func taskField(task *models.Task, name string) any {
+	switch name {
+	case "title":
+		return task.Title
+	case "body":
+		return task.Body
+	case "completed":
+		return task.Completed
+	case "due_at":
+		return normalizeTime(task.DueAt)
+	case "priority":
+		return task.Priority
+	case "recurrence":
+		return task.Recurrence
+	case "tags":
+		if len(task.Tags) == 0 {
+			return models.StringList(nil)
+		}
+		return task.Tags
+	case "checklist":
+		if len(task.Checklist) == 0 {
+			return models.Checklist(nil)
+		}
+		return task.Checklist
+	}
+	return nil
+}
+
+func setTaskField(task *models.Task, name string, value any) {
+	switch name {
+	case "title":
+		task.Title = value.(string)
+	case "body":
+		task.Body = value.(string)
+	case "completed":
+		task.Completed = value.(bool)
+	case "due_at":
+		task.DueAt = value.(*time.Time)
+	case "priority":
+		task.Priority = value.(string)
+	case "recurrence":
+		task.Recurrence = value.(string)
+	case "tags":
+		task.Tags = value.(models.StringList)
+	case "checklist":
+		task.Checklist = value.(models.Checklist)
+	}
+}
+
+// normalizeTime drops the location and the precision PostgreSQL does not
+// store.
+func normalizeTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.UTC().Truncate(time.Microsecond)
+	return &v
+}
+
+func sameValue(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func modifiedAt(change SyncChange) time.Time {
+	if change.ModifiedAt != nil {
+		return *change.ModifiedAt
+	}
+	return time.Now()
+}
@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/k1ender/task-master-go/internal/config"
 	"github.com/k1ender/task-master-go/internal/middleware"
 	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/quickadd"
 	"github.com/k1ender/task-master-go/internal/response"
 	"github.com/k1ender/task-master-go/internal/storage"
 	"github.com/k1ender/task-master-go/internal/utils"
+	"github.com/k1ender/task-master-go/internal/webhooks"
 )
 
 type TaskHandler struct {
@@ -30,8 +34,14 @@ func NewTaskHandler(store *storage.Storage, validator *validator.Validate, confi
 }
 
 type CreateTaskRequest struct {
-	Title string `json:"title" validate:"required"`
-	Body  string `json:"body" validate:"required"`
+	Title      string                 `json:"title" validate:"required"`
+	Body       string                 `json:"body" validate:"required"`
+	DueAt      *time.Time             `json:"due_at"`
+	Priority   string                 `json:"priority" validate:"omitempty,oneof=low medium high urgent"`
+	Recurrence string                 `json:"recurrence" validate:"omitempty,oneof=daily weekly monthly yearly"`
+	Tags       []string               `json:"tags" validate:"omitempty,dive,min=1"`
+	Checklist  []models.ChecklistItem `json:"checklist" validate:"omitempty,dive"`
+	ParentID   *uint                  `json:"parent_id"`
 }
 
 // @Summary Create a new task
@@ -60,13 +70,33 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if payload.ParentID != nil {
+		parent, err := h.store.Tasks.GetTask(*payload.ParentID)
+		if err != nil || parent.UserID != user.ID {
+			response.BadRequest(w, "Parent task not found")
+			return
+		}
+	}
+
 	task := models.Task{
-		Title:  payload.Title,
-		Body:   payload.Body,
-		UserID: user.ID,
+		Title:      payload.Title,
+		Body:       payload.Body,
+		DueAt:      payload.DueAt,
+		Priority:   payload.Priority,
+		Recurrence: payload.Recurrence,
+		Tags:       models.StringList(payload.Tags),
+		Checklist:  models.Checklist(payload.Checklist),
+		ParentID:   payload.ParentID,
+		UserID:     user.ID,
 	}
 
-	_, err := h.store.Tasks.CreateTask(&task)
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		if _, err := tx.Tasks.CreateTask(&task); err != nil {
+			return err
+		}
+
+		return publishTaskEvent(tx, models.EventTaskCreated, &task, nil)
+	})
 
 	if err != nil {
 		h.log.Error("failed to create task", slog.Any("error", err))
@@ -106,7 +136,9 @@ func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Task ID"
+// @Param If-None-Match header string false "ETag from a previous response"
 // @Success 200 {object} models.Task
+// @Success 304
 // @Failure 404 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /tasks/{id} [get]
@@ -123,14 +155,29 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Task ID"
+// @Param If-Match header string false "ETag the client last saw"
 // @Success 204
+// @Failure 409 {object} response.Response
+// @Failure 412 {object} response.Response
+// @Failure 428 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /tasks/{id} [delete]
 // @Security ApiKeyAuth
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	task := middleware.GetTaskFromContext(r.Context())
 
-	err := h.store.Tasks.DeleteTask(task.ID)
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		if err := tx.Tasks.DeleteTask(task); err != nil {
+			return err
+		}
+
+		return publishTaskEvent(tx, models.EventTaskDeleted, task, nil)
+	})
+
+	if errors.Is(err, storage.ErrVersionConflict) {
+		versionConflict(w, r)
+		return
+	}
 
 	if err != nil {
 		h.log.Error("failed to delete task", slog.Any("error", err))
@@ -142,9 +189,14 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 }
 
 type UpdateTaskRequest struct {
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	Completed bool   `json:"completed"`
+	Title      string                 `json:"title"`
+	Body       string                 `json:"body"`
+	Completed  bool                   `json:"completed"`
+	DueAt      *time.Time             `json:"due_at"`
+	Priority   string                 `json:"priority" validate:"omitempty,oneof=low medium high urgent"`
+	Recurrence string                 `json:"recurrence" validate:"omitempty,oneof=daily weekly monthly yearly"`
+	Tags       []string               `json:"tags" validate:"omitempty,dive,min=1"`
+	Checklist  []models.ChecklistItem `json:"checklist" validate:"omitempty,dive"`
 }
 
 // @Summary Update a task by ID
@@ -154,8 +206,12 @@ type UpdateTaskRequest struct {
 // @Produce json
 // @Param task body UpdateTaskRequest true "Task details"
 // @Param id path int true "Task ID"
+// @Param If-Match header string false "ETag the client last saw"
 // @Success 200 {object} models.Task
 // @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 412 {object} response.Response
+// @Failure 428 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /tasks/{id} [patch]
 // @Security ApiKeyAuth
@@ -186,15 +242,43 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if payload.Completed != task.Completed {
-		updates["completed"] = payload.Completed
+		setCompleted(updates, payload.Completed)
+	}
+
+	if payload.DueAt != nil {
+		updates["due_at"] = *payload.DueAt
+	}
+
+	if payload.Priority != "" {
+		updates["priority"] = payload.Priority
+	}
+
+	if payload.Recurrence != "" {
+		updates["recurrence"] = payload.Recurrence
+	}
+
+	if payload.Tags != nil {
+		updates["tags"] = models.StringList(payload.Tags)
+	}
+
+	if payload.Checklist != nil {
+		updates["checklist"] = models.Checklist(payload.Checklist)
 	}
 
 	if len(updates) == 0 {
+		w.Header().Set("ETag", middleware.TaskETag(task))
 		response.OK(w, task)
 		return
 	}
 
-	err := h.store.Tasks.UpdateTask(task, updates)
+	err := h.store.Transaction(func(tx *storage.Storage) error {
+		return applyTaskUpdates(tx, task, updates)
+	})
+
+	if errors.Is(err, storage.ErrVersionConflict) {
+		versionConflict(w, r)
+		return
+	}
 
 	if err != nil {
 		h.log.Error("failed to update task", slog.Any("error", err))
@@ -202,5 +286,157 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", middleware.TaskETag(task))
 	response.OK(w, task)
 }
+
+type QuickAddTaskRequest struct {
+	Text   string `json:"text" validate:"required"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type QuickAddTaskResponse struct {
+	Parsed quickadd.Result `json:"parsed"`
+	Task   *models.Task    `json:"task,omitempty"`
+}
+
+// @Summary Create a task from free-form text
+// @Description Parse text such as "Pay invoice tomorrow 5pm #finance !high every month" into a task, resolving dates in the user's timezone. With dry_run the parsed result is returned and nothing is created.
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Param task body QuickAddTaskRequest true "Quick add text"
+// @Success 200 {object} QuickAddTaskResponse
+// @Success 201 {object} QuickAddTaskResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /tasks/quick [post]
+// @Security ApiKeyAuth
+func (h *TaskHandler) QuickAddTask(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload QuickAddTaskRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		h.log.Warn("invalid user timezone, falling back to UTC", slog.String("timezone", user.Timezone))
+		loc = time.UTC
+	}
+
+	parsed := quickadd.Parse(payload.Text, time.Now().In(loc))
+
+	if payload.DryRun {
+		response.OK(w, QuickAddTaskResponse{Parsed: parsed})
+		return
+	}
+
+	if parsed.Title == "" {
+		response.BadRequest(w, "Title is required")
+		return
+	}
+
+	task := models.Task{
+		Title:      parsed.Title,
+		DueAt:      parsed.DueAt,
+		Priority:   parsed.Priority,
+		Recurrence: parsed.Recurrence,
+		Tags:       models.StringList(parsed.Tags),
+		UserID:     user.ID,
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if _, err := tx.Tasks.CreateTask(&task); err != nil {
+			return err
+		}
+
+		return publishTaskEvent(tx, models.EventTaskCreated, &task, nil)
+	})
+
+	if err != nil {
+		h.log.Error("failed to create task", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, QuickAddTaskResponse{Parsed: parsed, Task: &task})
+}
+
+// versionConflict reports that the task changed after it was loaded for
+// this request. With If-Match the precondition no longer holds, so it is a
+// 412; otherwise the client is asked to retry.
+func versionConflict(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		response.PreconditionFailed(w, "Task has been modified")
+		return
+	}
+
+	response.Conflict(w, "Task was modified by another request, please retry")
+}
+
+// setCompleted adds a change of the completed flag to updates, stamping or
+// clearing the completion time to match.
+func setCompleted(updates map[string]any, completed bool) {
+	updates["completed"] = completed
+	if completed {
+		updates["completed_at"] = time.Now()
+	} else {
+		updates["completed_at"] = nil
+	}
+}
+
+// applyTaskUpdates saves updates to task, moves its reminders along with
+// the due date and publishes the resulting events.
+func applyTaskUpdates(tx *storage.Storage, task *models.Task, updates map[string]any) error {
+	if err := tx.Tasks.UpdateTask(task, updates); err != nil {
+		return err
+	}
+
+	if _, ok := updates["due_at"]; ok {
+		if err := tx.Reminders.RescheduleReminders(task.ID, task.DueAt); err != nil {
+			return err
+		}
+	}
+
+	if err := publishTaskEvent(tx, models.EventTaskUpdated, task, updates); err != nil {
+		return err
+	}
+
+	if completed, ok := updates["completed"].(bool); ok && completed {
+		return publishTaskEvent(tx, models.EventTaskCompleted, task, nil)
+	}
+
+	return nil
+}
+
+// publishTaskEvent records a change to task in the event log streamed to
+// clients and queues webhook deliveries for it. changes lists the updated
+// columns for task.updated events. Call it inside the
+// transaction that makes the change, so the event is recorded if and only
+// if the change is committed.
+func publishTaskEvent(tx *storage.Storage, event string, task *models.Task, changes map[string]any) error {
+	payload, err := webhooks.NewPayload(event, task, changes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Events.AppendEvent(&models.Event{
+		UserID:  task.UserID,
+		Type:    event,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Webhooks.EnqueueEvent(task.UserID, event, payload, time.Now())
+}
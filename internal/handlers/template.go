@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+type TemplateHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewTemplateHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+// TemplateItemRequest is an item of a template, which becomes a subtask.
+type TemplateItemRequest struct {
+	Title            string   `json:"title" validate:"required"`
+	Body             string   `json:"body" validate:"required"`
+	DueOffsetMinutes *int     `json:"due_offset_minutes"`
+	Tags             []string `json:"tags" validate:"omitempty,dive,min=1"`
+	Checklist        []string `json:"checklist" validate:"omitempty,dive,min=1"`
+}
+
+type CreateTemplateRequest struct {
+	Name             string                `json:"name" validate:"required"`
+	Title            string                `json:"title" validate:"required"`
+	Body             string                `json:"body" validate:"required"`
+	DueOffsetMinutes *int                  `json:"due_offset_minutes"`
+	Tags             []string              `json:"tags" validate:"omitempty,dive,min=1"`
+	Checklist        []string              `json:"checklist" validate:"omitempty,dive,min=1"`
+	Items            []TemplateItemRequest `json:"items" validate:"dive"`
+}
+
+// @Summary Create a new task template
+// @Description Create a task template. Titles, bodies and checklist items of the template and its items may contain {{placeholders}}.
+// @Tags Template
+// @Accept json
+// @Produce json
+// @Param template body CreateTemplateRequest true "Template details"
+// @Success 201 {object} models.TaskTemplate
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /templates [post]
+// @Security ApiKeyAuth
+func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload CreateTemplateRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	template := models.TaskTemplate{
+		Name:             payload.Name,
+		Title:            payload.Title,
+		Body:             payload.Body,
+		DueOffsetMinutes: payload.DueOffsetMinutes,
+		Tags:             models.StringList(payload.Tags),
+		Checklist:        models.StringList(payload.Checklist),
+		Items:            make([]models.TaskTemplateItem, len(payload.Items)),
+		UserID:           user.ID,
+	}
+
+	for i, item := range payload.Items {
+		template.Items[i] = models.TaskTemplateItem{
+			Position:         i,
+			Title:            item.Title,
+			Body:             item.Body,
+			DueOffsetMinutes: item.DueOffsetMinutes,
+			Tags:             models.StringList(item.Tags),
+			Checklist:        models.StringList(item.Checklist),
+		}
+	}
+
+	if err := h.store.Templates.CreateTemplate(&template); err != nil {
+		h.log.Error("failed to create template", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, template)
+}
+
+// @Summary Get all task templates for a user
+// @Description Get all task templates for a user
+// @Tags Template
+// @Accept json
+// @Produce json
+// @Success 200 {object} []models.TaskTemplate
+// @Failure 500 {object} response.Response
+// @Router /templates [get]
+// @Security ApiKeyAuth
+func (h *TemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	templates, err := h.store.Templates.GetTemplates(user.ID)
+
+	if err != nil {
+		h.log.Error("failed to get templates", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, templates)
+}
+
+// @Summary Get a task template by ID
+// @Description Get a task template by ID
+// @Tags Template
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} models.TaskTemplate
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /templates/{id} [get]
+// @Security ApiKeyAuth
+func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template := middleware.GetTemplateFromContext(r.Context())
+
+	response.OK(w, template)
+}
+
+// @Summary Delete a task template by ID
+// @Description Delete a task template by ID
+// @Tags Template
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 204
+// @Failure 500 {object} response.Response
+// @Router /templates/{id} [delete]
+// @Security ApiKeyAuth
+func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template := middleware.GetTemplateFromContext(r.Context())
+
+	if err := h.store.Templates.DeleteTemplate(template.ID); err != nil {
+		h.log.Error("failed to delete template", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+type InstantiateTemplateRequest struct {
+	Variables map[string]string `json:"variables"`
+	// Anchor is the point in time due offsets are relative to. Defaults to now.
+	Anchor *time.Time `json:"anchor"`
+}
+
+// @Summary Instantiate a task template
+// @Description Create a task and one subtask per template item in a single transaction, substituting {{placeholders}} with the given variables. The task and subtasks get the tags and checklist of the template and of their item.
+// @Tags Template
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param variables body InstantiateTemplateRequest true "Template variables"
+// @Success 201 {object} models.Task
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /templates/{id}/instantiate [post]
+// @Security ApiKeyAuth
+func (h *TemplateHandler) InstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	template := middleware.GetTemplateFromContext(r.Context())
+	var payload InstantiateTemplateRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	anchor := time.Now()
+	if payload.Anchor != nil {
+		anchor = *payload.Anchor
+	}
+
+	root, err := instantiateTask(templateTask{
+		title:            template.Title,
+		body:             template.Body,
+		dueOffsetMinutes: template.DueOffsetMinutes,
+		tags:             template.Tags,
+		checklist:        template.Checklist,
+	}, payload.Variables, anchor)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	root.UserID = user.ID
+
+	subtasks := make([]models.Task, len(template.Items))
+	for i, item := range template.Items {
+		subtask, err := instantiateTask(templateTask{
+			title:            item.Title,
+			body:             item.Body,
+			dueOffsetMinutes: item.DueOffsetMinutes,
+			tags:             item.Tags,
+			checklist:        item.Checklist,
+		}, payload.Variables, anchor)
+		if err != nil {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		subtask.UserID = user.ID
+		subtasks[i] = *subtask
+	}
+
+	err = h.store.Transaction(func(tx *storage.Storage) error {
+		if _, err := tx.Tasks.CreateTask(root); err != nil {
+			return err
+		}
+
+		if err := publishTaskEvent(tx, models.EventTaskCreated, root, nil); err != nil {
+			return err
+		}
+
+		for i := range subtasks {
+			subtasks[i].ParentID = &root.ID
+			if _, err := tx.Tasks.CreateTask(&subtasks[i]); err != nil {
+				return err
+			}
+
+			if err := publishTaskEvent(tx, models.EventTaskCreated, &subtasks[i], nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		h.log.Error("failed to instantiate template", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	root.Subtasks = subtasks
+
+	response.Created(w, root)
+}
+
+// templateTask is the part of a template or template item that becomes a
+// task.
+type templateTask struct {
+	title            string
+	body             string
+	dueOffsetMinutes *int
+	tags             models.StringList
+	checklist        models.StringList
+}
+
+func instantiateTask(t templateTask, vars map[string]string, anchor time.Time) (*models.Task, error) {
+	title, err := utils.ExpandPlaceholders(t.title, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := utils.ExpandPlaceholders(t.body, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	task := &models.Task{Title: title, Body: body}
+	if len(t.tags) > 0 {
+		task.Tags = slices.Clone(t.tags)
+	}
+
+	for _, text := range t.checklist {
+		text, err := utils.ExpandPlaceholders(text, vars)
+		if err != nil {
+			return nil, err
+		}
+		task.Checklist = append(task.Checklist, models.ChecklistItem{Text: text})
+	}
+
+	if t.dueOffsetMinutes != nil {
+		dueAt := anchor.Add(time.Duration(*t.dueOffsetMinutes) * time.Minute)
+		task.DueAt = &dueAt
+	}
+
+	return task, nil
+}
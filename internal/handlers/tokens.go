@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/auth"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+const refreshTokenBytes = 32
+
+var (
+	errInvalidRefreshToken = errors.New("refresh token is expired or revoked")
+	errInvalidGrant        = errors.New("authorization code is invalid or expired")
+)
+
+type TokenResponse struct {
+	// Token is the access token, sent as "Authorization: Bearer <token>".
+	Token        string `json:"token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	// Scope lists the scopes of tokens issued to an OAuth client.
+	Scope string `json:"scope,omitempty"`
+}
+
+// startSession records a login from r and issues the first tokens of the
+// new session.
+func startSession(tx *storage.Storage, keys *auth.KeySet, cfg *config.Config, user *models.User, r *http.Request) (*TokenResponse, error) {
+	tokens, _, err := startClientSession(tx, keys, cfg, user, r, "", nil)
+	return tokens, err
+}
+
+// startClientSession is startSession for a session granted to an OAuth
+// client, whose tokens are limited to scopes.
+func startClientSession(tx *storage.Storage, keys *auth.KeySet, cfg *config.Config, user *models.User, r *http.Request, clientID string, scopes []string) (*TokenResponse, *models.Session, error) {
+	familyID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session := &models.Session{
+		UserID:          user.ID,
+		RefreshFamilyID: familyID,
+		UserAgent:       r.UserAgent(),
+		IP:              utils.ClientIP(r),
+		ClientID:        clientID,
+		Scopes:          models.StringList(scopes),
+		LastSeenAt:      time.Now(),
+	}
+	if err := tx.Sessions.CreateSession(session); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, _, err := issueTokens(tx, keys, cfg, user, session)
+	return tokens, session, err
+}
+
+// issueTokens signs an access token for user in session and stores a new
+// refresh token in the session's family.
+func issueTokens(tx *storage.Storage, keys *auth.KeySet, cfg *config.Config, user *models.User, session *models.Session) (*TokenResponse, *models.RefreshToken, error) {
+	claims := utils.AuthClaims{UserID: user.ID, Generation: user.TokenGeneration, SessionID: session.ID}
+	if session.ClientID != "" {
+		claims.ClientID = session.ClientID
+		claims.Scopes = []string(session.Scopes)
+	}
+	access, err := utils.SignToken(claims, cfg.JWT.AccessTokenTTL, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, err := utils.RandomToken(refreshTokenBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  session.RefreshFamilyID,
+		TokenHash: utils.HashToken(refresh),
+		ExpiresAt: time.Now().Add(cfg.JWT.RefreshTokenTTL),
+	}
+	if err := tx.RefreshTokens.CreateRefreshToken(token); err != nil {
+		return nil, nil, err
+	}
+
+	return &TokenResponse{
+		Token:        access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(cfg.JWT.AccessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(claims.Scopes, " "),
+	}, token, nil
+}
+
+// exchangeRefreshToken issues new tokens for a refresh token of a session
+// started by clientID, which is empty for first-party logins. The refresh
+// token is used up. If it had been used before, nothing is issued and its
+// session is returned to be revoked.
+func exchangeRefreshToken(tx *storage.Storage, keys *auth.KeySet, cfg *config.Config, r *http.Request, refreshToken, clientID string) (*TokenResponse, *models.Session, error) {
+	token, err := tx.RefreshTokens.GetRefreshTokenForUpdate(utils.HashToken(refreshToken))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	session, err := tx.Sessions.GetSessionByFamily(token.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if session.ClientID != clientID {
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	// A token that was already exchanged has leaked, either from the
+	// client or on its way to it. Which copy is legitimate is unknown,
+	// so the whole session is revoked and the user has to log in again.
+	if token.UsedAt != nil {
+		return nil, session, nil
+	}
+
+	if session.RevokedAt != nil {
+		return nil, nil, errInvalidRefreshToken
+	}
+
+	user, err := tx.Users.GetUser(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Sessions.TouchSession(session, utils.ClientIP(r), r.UserAgent()); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, next, err := issueTokens(tx, keys, cfg, user, session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, nil, tx.RefreshTokens.MarkRefreshTokenUsed(token, next.ID)
+}
+
+// revokeSession ends session: its refresh tokens stop working at once, and
+// its access tokens are denied until the last of them would have expired.
+func revokeSession(store *storage.Storage, denylist *auth.Denylist, cfg *config.Config, session *models.Session) error {
+	err := store.Transaction(func(tx *storage.Storage) error {
+		if err := tx.Sessions.RevokeSession(session); err != nil {
+			return err
+		}
+
+		return tx.RefreshTokens.RevokeRefreshTokenFamily(session.RefreshFamilyID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return denylist.RevokeSession(session.ID, time.Now().Add(cfg.JWT.AccessTokenTTL))
+}
+
+// revokeAllSessions signs user out everywhere. Bumping the token generation
+// invalidates every access token without listing them.
+func revokeAllSessions(tx *storage.Storage, user *models.User) error {
+	if err := tx.Users.BumpTokenGeneration(user); err != nil {
+		return err
+	}
+
+	if err := tx.Sessions.RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+
+	return tx.RefreshTokens.RevokeUserRefreshTokens(user.ID)
+}
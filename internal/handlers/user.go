@@ -3,24 +3,34 @@ package handlers
 import (
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/digest"
 	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
 	"github.com/k1ender/task-master-go/internal/response"
 	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
 	store    *storage.Storage
+	notifier notify.Notifier
 	validate *validator.Validate
 	config   *config.Config
 	log      *slog.Logger
 }
 
-func NewUserHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *UserHandler {
+func NewUserHandler(store *storage.Storage, notifier notify.Notifier, validator *validator.Validate, config *config.Config, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
 		store:    store,
+		notifier: notifier,
 		validate: validator,
 		config:   config,
 		log:      logger,
@@ -40,3 +50,351 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetAuthUserFromContext(r.Context())
 	response.OK(w, user)
 }
+
+type UpdateUserRequest struct {
+	Timezone string `json:"timezone"`
+}
+
+// @Summary Update user details
+// @Description Update user details. Timezone must be an IANA name such as "Europe/Berlin".
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param user body UpdateUserRequest true "User details"
+// @Success 200 {object} models.User
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user [patch]
+// @Security ApiKeyAuth
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload UpdateUserRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	updates := map[string]any{}
+
+	if payload.Timezone != "" {
+		if _, err := time.LoadLocation(payload.Timezone); err != nil {
+			response.BadRequest(w, "Invalid timezone")
+			return
+		}
+		updates["timezone"] = payload.Timezone
+	}
+
+	if len(updates) == 0 {
+		response.OK(w, user)
+		return
+	}
+
+	if err := h.store.Users.UpdateUser(user, updates); err != nil {
+		h.log.Error("failed to update user", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, user)
+}
+
+type UpdateEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// @Summary Change email address
+// @Description Set the email address of the current user. The address is unverified until the link sent to it is followed.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param email body UpdateEmailRequest true "Email address"
+// @Success 200 {object} models.User
+// @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/email [put]
+// @Security ApiKeyAuth
+func (h *UserHandler) UpdateEmail(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload UpdateEmailRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	email := strings.ToLower(payload.Email)
+	if user.Email != nil && *user.Email == email {
+		response.OK(w, user)
+		return
+	}
+
+	err := h.store.Users.UpdateUser(user, map[string]any{
+		"email":             email,
+		"email_verified_at": nil,
+	})
+	if err != nil {
+		if err, ok := err.(*pgconn.PgError); ok && err.ConstraintName == "idx_users_email" {
+			response.Conflict(w, "Email already in use")
+			return
+		}
+		h.log.Error("failed to update user", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if err := sendEmailVerification(r.Context(), h.notifier, h.config, user); err != nil {
+		h.log.Error("failed to send email verification", slog.Any("error", err))
+	}
+
+	response.OK(w, user)
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// @Summary Verify email address
+// @Description Confirm the current email address with the token from the verification link
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param token body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} models.User
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/email/verify [post]
+// @Security ApiKeyAuth
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload VerifyEmailRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if user.Email == nil {
+		response.BadRequest(w, "No email address to verify")
+		return
+	}
+
+	userID, err := utils.ParseActionToken(payload.Token, verifyEmailAction(*user.Email), h.config.JWT.Secret)
+	if err != nil || userID != user.ID {
+		response.BadRequest(w, "Invalid or expired verification link")
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.store.Users.UpdateUser(user, map[string]any{"email_verified_at": time.Now()}); err != nil {
+			h.log.Error("failed to update user", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	response.OK(w, user)
+}
+
+// @Summary Email verification page
+// @Description The page the verification link in emails opens. It asks the user to confirm, and the confirmation is posted to /email/verify.
+// @Tags User
+// @Produce html
+// @Param token query string true "Verification token from the email"
+// @Success 200
+// @Router /email/verify [get]
+func (h *UserHandler) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, http.StatusOK, linkPage{
+		Title:   "Verify your email address",
+		Message: "Confirm that this email address belongs to your Task Master account.",
+		Action:  "/email/verify",
+		Token:   r.URL.Query().Get("token"),
+		Button:  "Verify email address",
+	}, h.log)
+}
+
+// @Summary Verify email address from a link
+// @Description Submitted by the email verification page. Verifies the address the token was sent to, if it is still the user's address; no login is needed.
+// @Tags User
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param token formData string true "Verification token from the email"
+// @Success 200
+// @Failure 400
+// @Router /email/verify [post]
+func (h *UserHandler) VerifyEmailLink(w http.ResponseWriter, r *http.Request) {
+	page := linkPage{Title: "Verify your email address"}
+
+	user, err := h.emailLinkUser(r.FormValue("token"))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			page.Error = "This verification link is invalid or has expired."
+			renderLinkPage(w, http.StatusBadRequest, page, h.log)
+			return
+		}
+		h.log.Error("failed to get user", slog.Any("error", err))
+		page.Error = "Something went wrong, please try again later."
+		renderLinkPage(w, http.StatusInternalServerError, page, h.log)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.store.Users.UpdateUser(user, map[string]any{"email_verified_at": time.Now()}); err != nil {
+			h.log.Error("failed to update user", slog.Any("error", err))
+			page.Error = "Something went wrong, please try again later."
+			renderLinkPage(w, http.StatusInternalServerError, page, h.log)
+			return
+		}
+	}
+
+	page.Message = "Your email address " + *user.Email + " is verified."
+	renderLinkPage(w, http.StatusOK, page, h.log)
+}
+
+// emailLinkUser returns the user a verification token was issued to, or
+// gorm.ErrRecordNotFound if the token is invalid or was sent to an address
+// the user no longer has.
+func (h *UserHandler) emailLinkUser(token string) (*models.User, error) {
+	claims, err := utils.ParseActionClaims(token, h.config.JWT.Secret)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	user, err := h.store.Users.GetUser(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Email == nil || claims.Action != verifyEmailAction(*user.Email) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+type UpdateDigestRequest struct {
+	Frequency string `json:"frequency" validate:"required,oneof=off daily weekly"`
+	// Time is the local send time, formatted as "15:04".
+	Time    string        `json:"time" validate:"omitempty,datetime=15:04"`
+	Weekday *time.Weekday `json:"weekday" validate:"omitempty,min=0,max=6" swaggertype:"integer"`
+}
+
+// @Summary Update digest preferences
+// @Description Choose whether to receive a daily or weekly digest email of due, overdue and completed tasks, and when to receive it
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param digest body UpdateDigestRequest true "Digest preferences"
+// @Success 200 {object} models.User
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/digest [put]
+// @Security ApiKeyAuth
+func (h *UserHandler) UpdateDigest(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload UpdateDigestRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	updates := map[string]any{
+		"digest_frequency": payload.Frequency,
+	}
+
+	if payload.Time != "" {
+		updates["digest_time"] = payload.Time
+	}
+
+	if payload.Weekday != nil {
+		updates["digest_weekday"] = *payload.Weekday
+	}
+
+	if err := h.store.Users.UpdateUser(user, updates); err != nil {
+		h.log.Error("failed to update user", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, user)
+}
+
+// @Summary Digest unsubscribe page
+// @Description The page the unsubscribe link in digest emails opens. It only asks for confirmation; its button submits the token to POST /digest/unsubscribe.
+// @Tags User
+// @Produce html
+// @Param token query string true "Unsubscribe token"
+// @Success 200
+// @Router /digest/unsubscribe [get]
+func (h *UserHandler) UnsubscribeDigestPage(w http.ResponseWriter, r *http.Request) {
+	renderLinkPage(w, http.StatusOK, linkPage{
+		Title:   "Unsubscribe from digest emails",
+		Message: "Stop receiving digest emails from Task Master.",
+		Action:  "/digest/unsubscribe",
+		Token:   r.URL.Query().Get("token"),
+		Button:  "Unsubscribe",
+	}, h.log)
+}
+
+// @Summary Unsubscribe from digest emails
+// @Description Submitted by the unsubscribe page. Turns off digest emails using the signed token from the unsubscribe link, given in the form or the query. Does not require authentication.
+// @Tags User
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param token formData string true "Unsubscribe token"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Router /digest/unsubscribe [post]
+func (h *UserHandler) UnsubscribeDigest(w http.ResponseWriter, r *http.Request) {
+	page := linkPage{Title: "Unsubscribe from digest emails"}
+
+	userID, err := utils.ParseActionToken(r.FormValue("token"), digest.UnsubscribeAction, h.config.JWT.Secret)
+	if err != nil {
+		page.Error = "This unsubscribe link is invalid."
+		renderLinkPage(w, http.StatusBadRequest, page, h.log)
+		return
+	}
+
+	user, err := h.store.Users.GetUser(userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			page.Error = "This unsubscribe link is invalid."
+			renderLinkPage(w, http.StatusBadRequest, page, h.log)
+			return
+		}
+		h.log.Error("failed to get user", slog.Any("error", err))
+		page.Error = "Something went wrong, please try again later."
+		renderLinkPage(w, http.StatusInternalServerError, page, h.log)
+		return
+	}
+
+	if err := h.store.Users.UpdateUser(user, map[string]any{"digest_frequency": models.DigestOff}); err != nil {
+		h.log.Error("failed to update user", slog.Any("error", err))
+		page.Error = "Something went wrong, please try again later."
+		renderLinkPage(w, http.StatusInternalServerError, page, h.log)
+		return
+	}
+
+	page.Message = "You have been unsubscribed from digest emails."
+	renderLinkPage(w, http.StatusOK, page, h.log)
+}
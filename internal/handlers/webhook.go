@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+	"github.com/k1ender/task-master-go/internal/webhooks"
+	"gorm.io/gorm"
+)
+
+const webhookDeliveriesLimit = 100
+
+type WebhookHandler struct {
+	store    *storage.Storage
+	validate *validator.Validate
+	config   *config.Config
+	log      *slog.Logger
+}
+
+func NewWebhookHandler(store *storage.Storage, validator *validator.Validate, config *config.Config, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		store:    store,
+		validate: validator,
+		config:   config,
+		log:      logger,
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,http_url"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=task.created task.updated task.completed task.deleted"`
+	// Secret signs the payloads. A random secret is generated when empty.
+	Secret string `json:"secret" validate:"omitempty,min=16"`
+}
+
+type CreateWebhookResponse struct {
+	models.Webhook
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret"`
+}
+
+// @Summary Register a webhook
+// @Description Register a URL that receives HMAC-signed JSON payloads for the selected task events. The X-Webhook-Signature header has the form "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param webhook body CreateWebhookRequest true "Webhook details"
+// @Success 201 {object} CreateWebhookResponse
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks [post]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+	var payload CreateWebhookRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	if err := webhooks.ValidateURL(r.Context(), payload.URL); err != nil {
+		response.BadRequest(w, "Invalid webhook URL: "+err.Error())
+		return
+	}
+
+	secret := payload.Secret
+	if secret == "" {
+		var err error
+		if secret, err = utils.RandomToken(32); err != nil {
+			h.log.Error("failed to generate webhook secret", slog.Any("error", err))
+			response.InternalServerError(w)
+			return
+		}
+	}
+
+	webhook := models.Webhook{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: secret,
+		Events: models.StringList(payload.Events),
+		Active: true,
+	}
+
+	if err := h.store.Webhooks.CreateWebhook(&webhook); err != nil {
+		h.log.Error("failed to create webhook", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, CreateWebhookResponse{Webhook: webhook, Secret: secret})
+}
+
+// @Summary Get all webhooks for a user
+// @Description Get all webhooks for a user
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Success 200 {object} []models.Webhook
+// @Failure 500 {object} response.Response
+// @Router /webhooks [get]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetAuthUserFromContext(r.Context())
+
+	webhooks, err := h.store.Webhooks.GetWebhooks(user.ID)
+
+	if err != nil {
+		h.log.Error("failed to get webhooks", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, webhooks)
+}
+
+// @Summary Get a webhook by ID
+// @Description Get a webhook by ID
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks/{id} [get]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := middleware.GetWebhookFromContext(r.Context())
+
+	response.OK(w, webhook)
+}
+
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url" validate:"omitempty,http_url"`
+	Events []string `json:"events" validate:"omitempty,min=1,dive,oneof=task.created task.updated task.completed task.deleted"`
+	// Active re-enables a webhook that was disabled after repeated failures, or disables it.
+	Active *bool `json:"active"`
+}
+
+// @Summary Update a webhook by ID
+// @Description Update a webhook by ID
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param webhook body UpdateWebhookRequest true "Webhook details"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks/{id} [patch]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := middleware.GetWebhookFromContext(r.Context())
+	var payload UpdateWebhookRequest
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		h.log.Error("failed to read request body", slog.Any("error", err))
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	if err := h.validate.Struct(payload); err != nil {
+		h.log.Error("failed to validate request body", slog.Any("error", err))
+		response.ValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	updates := map[string]any{}
+
+	if payload.URL != "" {
+		if err := webhooks.ValidateURL(r.Context(), payload.URL); err != nil {
+			response.BadRequest(w, "Invalid webhook URL: "+err.Error())
+			return
+		}
+		updates["url"] = payload.URL
+	}
+
+	if payload.Events != nil {
+		updates["events"] = models.StringList(payload.Events)
+	}
+
+	if payload.Active != nil && *payload.Active != webhook.Active {
+		updates["active"] = *payload.Active
+		if *payload.Active {
+			updates["consecutive_failures"] = 0
+			updates["disabled_at"] = nil
+		} else {
+			updates["disabled_at"] = time.Now()
+		}
+	}
+
+	if len(updates) == 0 {
+		response.OK(w, webhook)
+		return
+	}
+
+	if err := h.store.Webhooks.UpdateWebhook(webhook, updates); err != nil {
+		h.log.Error("failed to update webhook", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, webhook)
+}
+
+// @Summary Delete a webhook by ID
+// @Description Delete a webhook and its delivery log
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks/{id} [delete]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := middleware.GetWebhookFromContext(r.Context())
+
+	if err := h.store.Webhooks.DeleteWebhook(webhook.ID); err != nil {
+		h.log.Error("failed to delete webhook", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// @Summary Get the delivery log of a webhook
+// @Description Get the most recent deliveries of a webhook
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} []models.WebhookDelivery
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks/{id}/deliveries [get]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook := middleware.GetWebhookFromContext(r.Context())
+
+	deliveries, err := h.store.Webhooks.GetDeliveries(webhook.ID, webhookDeliveriesLimit)
+
+	if err != nil {
+		h.log.Error("failed to get webhook deliveries", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, deliveries)
+}
+
+// @Summary Redeliver a webhook delivery
+// @Description Queue a new delivery with the same event and payload
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param deliveryID path int true "Delivery ID"
+// @Success 201 {object} models.WebhookDelivery
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /webhooks/{id}/deliveries/{deliveryID}/redeliver [post]
+// @Security ApiKeyAuth
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	webhook := middleware.GetWebhookFromContext(r.Context())
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryID"))
+	if err != nil || deliveryID < 0 {
+		response.BadRequest(w, "Bad Request")
+		return
+	}
+
+	original, err := h.store.Webhooks.GetDelivery(uint(deliveryID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.NotFound(w, "Delivery not found")
+			return
+		}
+		h.log.Error("failed to get webhook delivery", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	if original.WebhookID != webhook.ID {
+		response.NotFound(w, "Delivery not found")
+		return
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	if err := h.store.Webhooks.CreateDelivery(&delivery); err != nil {
+		h.log.Error("failed to create webhook delivery", slog.Any("error", err))
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, delivery)
+}
@@ -2,67 +2,228 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/k1ender/task-master-go/internal/auth"
 	"github.com/k1ender/task-master-go/internal/models"
 	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/utils"
 	"gorm.io/gorm"
 )
 
 type AuthKey string
 
-const AuthKeyUser AuthKey = "user"
+const (
+	AuthKeyUser   AuthKey = "user"
+	AuthKeyClaims AuthKey = "claims"
+)
 
 func GetAuthUserFromContext(ctx context.Context) *models.User {
 	return ctx.Value(AuthKeyUser).(*models.User)
 }
 
-func Auth(db *gorm.DB, jwtSecret string) func(http.Handler) http.Handler {
+// GetAuthClaimsFromContext returns the claims of the access token the
+// request was authenticated with.
+func GetAuthClaimsFromContext(ctx context.Context) *utils.AuthClaims {
+	return ctx.Value(AuthKeyClaims).(*utils.AuthClaims)
+}
+
+// accessTokenTouchInterval limits how often last_used_at of a personal
+// access token is written.
+const accessTokenTouchInterval = time.Minute
+
+// ErrUnauthorized is returned by an Authenticator for credentials that are
+// missing, invalid, expired or revoked.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authenticator checks the value of an Authorization header: a JWT access
+// token or a personal access token after "Bearer ".
+type Authenticator func(authorization string) (*models.User, *utils.AuthClaims, error)
+
+func NewAuthenticator(db *gorm.DB, keys *auth.KeySet, denylist *auth.Denylist) Authenticator {
+	return func(authorization string) (*models.User, *utils.AuthClaims, error) {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok || token == "" {
+			return nil, nil, ErrUnauthorized
+		}
+
+		var (
+			user   *models.User
+			claims *utils.AuthClaims
+			err    error
+		)
+		if strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+			user, claims, err = authenticateAccessToken(db, token)
+		} else {
+			user, claims, err = authenticateJWT(db, token, keys, denylist)
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrUnauthorized
+		}
+		return user, claims, err
+	}
+}
+
+// Auth authenticates requests with a JWT access token or a personal access
+// token in the Authorization header.
+func Auth(db *gorm.DB, keys *auth.KeySet, denylist *auth.Denylist) func(http.Handler) http.Handler {
+	authenticate := NewAuthenticator(db, keys, denylist)
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := r.Header.Get("Authorization")
-
-			if token == "" || !strings.HasPrefix(token, "Bearer ") {
-				response.Unauthorized(w, "Unauthorized")
+			user, claims, err := authenticate(r.Header.Get("Authorization"))
+			if err != nil {
+				if errors.Is(err, ErrUnauthorized) {
+					response.Unauthorized(w, "Unauthorized")
+					return
+				}
+				response.InternalServerError(w)
 				return
 			}
 
-			token = strings.TrimPrefix(token, "Bearer ")
+			ctx := context.WithValue(r.Context(), AuthKeyUser, user)
+			ctx = context.WithValue(ctx, AuthKeyClaims, claims)
 
-			validatedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-				return []byte(jwtSecret), nil
-			}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			if err != nil {
-				response.Unauthorized(w, "Unauthorized")
+func authenticateJWT(db *gorm.DB, token string, keys *auth.KeySet, denylist *auth.Denylist) (*models.User, *utils.AuthClaims, error) {
+	claims, err := utils.ParseToken(token, keys)
+	if err != nil {
+		return nil, nil, ErrUnauthorized
+	}
+
+	if denylist.IsRevoked(claims.ID) || denylist.IsSessionRevoked(claims.SessionID) {
+		return nil, nil, ErrUnauthorized
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// Tokens from before the user's last "log out everywhere".
+	if claims.Generation != user.TokenGeneration {
+		return nil, nil, ErrUnauthorized
+	}
+
+	return &user, claims, nil
+}
+
+// authenticateAccessToken looks up a personal access token. The request
+// gets claims carrying only the token's scopes.
+func authenticateAccessToken(db *gorm.DB, token string) (*models.User, *utils.AuthClaims, error) {
+	var pat models.PersonalAccessToken
+	if err := db.Where("token_hash = ?", utils.HashToken(token)).First(&pat).Error; err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if pat.ExpiresAt != nil && now.After(*pat.ExpiresAt) {
+		return nil, nil, ErrUnauthorized
+	}
+
+	var user models.User
+	if err := db.First(&user, pat.UserID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > accessTokenTouchInterval {
+		if err := db.Model(&pat).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	scopes := []string(pat.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	claims := &utils.AuthClaims{UserID: user.ID, Scopes: scopes}
+	if pat.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*pat.ExpiresAt)
+	}
+
+	return &user, claims, nil
+}
+
+// HasScope reports whether the request was authenticated with a token that
+// may be used for scope.
+func HasScope(ctx context.Context, scope string) bool {
+	claims := GetAuthClaimsFromContext(ctx)
+	return claims.Scopes == nil || slices.Contains(claims.Scopes, scope)
+}
+
+// RequireScope rejects requests whose token lacks scope with 403 Forbidden.
+// It must run after Auth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasScope(r.Context(), scope) {
+				response.Forbidden(w, "Token is missing the "+scope+" scope")
 				return
 			}
 
-			var userID int
+			h.ServeHTTP(w, r)
+		})
+	}
+}
 
-			if claims, ok := validatedToken.Claims.(jwt.MapClaims); ok {
-				userID = int(claims["user_id"].(float64))
-			} else {
-				response.Unauthorized(w, "Unauthorized")
+// RequireScopeByMethod requires read for GET and HEAD requests and write
+// for everything else.
+func RequireScopeByMethod(read, write string) func(http.Handler) http.Handler {
+	requireRead, requireWrite := RequireScope(read), RequireScope(write)
+	return func(h http.Handler) http.Handler {
+		readHandler, writeHandler := requireRead(h), requireWrite(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				readHandler.ServeHTTP(w, r)
 				return
 			}
 
-			var user models.User
+			writeHandler.ServeHTTP(w, r)
+		})
+	}
+}
 
-			if res := db.First(&user, userID); res.Error != nil {
-				if res.Error == gorm.ErrRecordNotFound {
-					response.Unauthorized(w, "Unauthorized")
-					return
-				}
-				response.InternalServerError(w)
-				return
+// TokenFromQuery copies a bearer token from the given query parameter into
+// the Authorization header when the header is missing. It is meant for
+// clients such as browser WebSockets that cannot set request headers.
+func TokenFromQuery(param string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := r.URL.Query().Get(param); token != "" && r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+token)
 			}
 
-			ctx := context.WithValue(r.Context(), AuthKeyUser, &user)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
 
-			h.ServeHTTP(w, r.WithContext(ctx))
+// RequireVerifiedEmail rejects users without a verified email address with
+// 403 Forbidden. It does nothing unless enabled, and must run after Auth.
+func RequireVerifiedEmail(enabled bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if !enabled {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetAuthUserFromContext(r.Context())
+			if user.VerifiedEmail() == "" {
+				response.Forbidden(w, "A verified email address is required")
+				return
+			}
+
+			h.ServeHTTP(w, r)
 		})
 	}
 }
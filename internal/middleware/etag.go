@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+)
+
+// TaskETag returns the entity tag of task, derived from its version.
+func TaskETag(task *models.Task) string {
+	return `"` + strconv.FormatUint(uint64(task.Version), 10) + `"`
+}
+
+// TaskPreconditions evaluates conditional request headers against the task
+// loaded by TaskMiddleware. Reads get an ETag and honour If-None-Match with
+// 304 Not Modified. Writes honour If-Match with 412 Precondition Failed, and
+// when required is set, fail with 428 Precondition Required without it.
+func TaskPreconditions(required bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			task := GetTaskFromContext(r.Context())
+			etag := TaskETag(task)
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				w.Header().Set("ETag", etag)
+				if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+					response.NotModified(w)
+					return
+				}
+			default:
+				match := r.Header.Get("If-Match")
+				if match == "" {
+					if required {
+						response.PreconditionRequired(w, "If-Match header is required")
+						return
+					}
+				} else if !etagMatches(match, etag, false) {
+					w.Header().Set("ETag", etag)
+					response.PreconditionFailed(w, "Task has been modified")
+					return
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// etagMatches reports whether etag is in the comma-separated list header.
+// Weak comparison, used by If-None-Match, ignores the W/ prefix; strong
+// comparison, used by If-Match, never matches a weak tag.
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
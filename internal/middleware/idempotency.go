@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20
+	// idempotencyLease is how long a request may hold its key before a
+	// retry is allowed to assume it was abandoned.
+	idempotencyLease = time.Minute
+)
+
+// Idempotency makes POST requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key runs normally and its response is kept
+// for ttl; repeats with the same body get the stored response back, marked
+// with Idempotent-Replayed, and repeats with a different body are rejected.
+// Keys are scoped to the authenticated user, so mount it after Auth;
+// requests without a user pass through untouched, as anonymous callers would
+// otherwise share one key space. Server errors are not stored, so they can
+// be retried, and neither are responses marked Cache-Control: no-store,
+// which carry credentials that must not be kept or handed out twice.
+func Idempotency(store storage.IdempotencyStore, ttl time.Duration, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get("Idempotency-Key")
+			user, authenticated := r.Context().Value(AuthKeyUser).(*models.User)
+			if r.Method != http.MethodPost || idempotencyKey == "" || !authenticated {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				response.BadRequest(w, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				response.BadRequest(w, "Bad Request")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := sha256.New()
+			io.WriteString(fingerprint, r.Method+" "+r.URL.RequestURI()+"\n")
+			fingerprint.Write(body)
+
+			key := &models.IdempotencyKey{
+				Scope:       "user:" + strconv.FormatUint(uint64(user.ID), 10),
+				Key:         idempotencyKey,
+				Fingerprint: hex.EncodeToString(fingerprint.Sum(nil)),
+				ExpiresAt:   time.Now().Add(idempotencyLease),
+			}
+
+			existing, reserved, err := store.ReserveKey(key)
+			if err != nil {
+				logger.Error("failed to reserve idempotency key", slog.Any("error", err))
+				response.InternalServerError(w)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case existing.Fingerprint != key.Fingerprint:
+					response.UnprocessableEntity(w, "Idempotency-Key was already used with a different request")
+				case !existing.Completed:
+					response.Conflict(w, "A request with this Idempotency-Key is still in progress")
+				default:
+					if existing.ContentType != "" {
+						w.Header().Set("Content-Type", existing.ContentType)
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(existing.Status)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.ReleaseKey(key); err != nil {
+					logger.Error("failed to release idempotency key", slog.Any("error", err))
+				}
+			}()
+
+			h.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError || noStore(rec.Header()) {
+				return
+			}
+
+			key.Status = rec.status
+			key.ContentType = rec.Header().Get("Content-Type")
+			key.Body = rec.body.Bytes()
+			if err := store.CompleteKey(key, time.Now().Add(ttl)); err != nil {
+				logger.Error("failed to store idempotent response", slog.Any("error", err))
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// NoStore marks responses with Cache-Control: no-store. Use it on routes
+// whose responses contain secrets, such as tokens; Idempotency does not
+// store them either.
+func NoStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/ratelimit"
+	"github.com/k1ender/task-master-go/internal/response"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+// RateLimit limits requests to limit per client, counting the routes of
+// group together. Clients are the authenticated user when mounted after
+// Auth, and the peer address otherwise. Every response carries the
+// RateLimit-* headers of draft-ietf-httpapi-ratelimit-headers; rejected
+// requests get 429 Too Many Requests with Retry-After. If the store fails,
+// requests are let through.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if limit.Unlimited() {
+			return h
+		}
+
+		policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(int(limit.Period.Seconds()))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := group + ":ip:" + utils.ClientIP(r)
+			if user, ok := r.Context().Value(AuthKeyUser).(*models.User); ok {
+				key = group + ":user:" + strconv.FormatUint(uint64(user.ID), 10)
+			}
+
+			result, err := store.Take(r.Context(), key, limit)
+			if err != nil {
+				logger.Error("failed to take rate limit token", slog.Any("error", err))
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				response.TooManyRequests(w, "Too many requests")
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
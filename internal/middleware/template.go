@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"gorm.io/gorm"
+)
+
+type TemplateKeyType string
+
+const TemplateKey TemplateKeyType = "template"
+
+func TemplateMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetAuthUserFromContext(r.Context())
+			templateID, err := strconv.Atoi(chi.URLParam(r, "id"))
+			if err != nil || templateID < 0 {
+				response.BadRequest(w, "Bad Request")
+				return
+			}
+
+			var template models.TaskTemplate
+			res := db.
+				Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+				Where("id = ? AND user_id = ?", templateID, user.ID).
+				First(&template)
+
+			if res.Error != nil {
+				if res.Error == gorm.ErrRecordNotFound {
+					response.NotFound(w, "Template not found")
+					return
+				}
+				response.InternalServerError(w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), TemplateKey, &template)
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func GetTemplateFromContext(ctx context.Context) *models.TaskTemplate {
+	return ctx.Value(TemplateKey).(*models.TaskTemplate)
+}
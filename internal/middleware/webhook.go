@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/response"
+	"gorm.io/gorm"
+)
+
+type WebhookKeyType string
+
+const WebhookKey WebhookKeyType = "webhook"
+
+func WebhookMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetAuthUserFromContext(r.Context())
+			webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+			if err != nil {
+				response.BadRequest(w, "Bad Request")
+				return
+			}
+
+			if webhookID < 0 {
+				response.BadRequest(w, "Bad Request")
+				return
+			}
+
+			var webhook models.Webhook
+			res := db.Where("id = ? AND user_id = ?", webhookID, user.ID).First(&webhook)
+
+			if res.Error != nil {
+				if res.Error == gorm.ErrRecordNotFound {
+					response.NotFound(w, "Webhook not found")
+					return
+				}
+				response.InternalServerError(w)
+				return
+			}
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, WebhookKey, &webhook)
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func GetWebhookFromContext(ctx context.Context) *models.Webhook {
+	return ctx.Value(WebhookKey).(*models.Webhook)
+}
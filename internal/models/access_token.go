@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells
+// them apart from JWTs and makes leaked tokens easy to scan for.
+const PersonalAccessTokenPrefix = "tmp_"
+
+// PersonalAccessToken is a long-lived credential for scripts and CI. It is
+// limited to Scopes, and only a hash of the token is stored; Prefix keeps
+// its first characters so users can tell their tokens apart.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     StringList `json:"scopes" gorm:"type:text;not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
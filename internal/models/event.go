@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Event is an entry in the bounded log of changes streamed to clients.
+// Payload holds the JSON document sent as the event data.
+type Event struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;index:idx_events_user_id_id"`
+	Type      string    `json:"type" gorm:"not null"`
+	Payload   string    `json:"payload" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
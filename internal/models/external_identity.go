@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ExternalIdentity links an account at an OpenID Connect provider, named by
+// the provider's issuer and the subject it gives the account, to a user.
+type ExternalIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"-" gorm:"not null;index"`
+	Issuer      string    `json:"issuer" gorm:"not null;uniqueIndex:idx_external_identities_subject"`
+	Subject     string    `json:"subject" gorm:"not null;uniqueIndex:idx_external_identities_subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState is a login started at the provider and not finished yet.
+// The state parameter, of which only a hash is stored, is also kept in a
+// cookie, so the callback is only accepted in the browser that started it.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"not null;uniqueIndex"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
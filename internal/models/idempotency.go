@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a POST request sent with an
+// Idempotency-Key header, so that retries replay it instead of repeating
+// the request. Fingerprint identifies the request the key was first used
+// with. While Completed is false the request is still being processed and
+// ExpiresAt is a short lease that lets a retry take over if the server died
+// mid-request.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey"`
+	Scope       string    `gorm:"not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Key         string    `gorm:"not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Fingerprint string    `gorm:"not null"`
+	Completed   bool      `gorm:"not null;default:false"`
+	Status      int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"not null;default:''"`
+	Body        []byte    `gorm:"type:bytea"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginFailure counts the failed logins for one key: an account, or the
+// address the attempts came from. The count starts over once the last
+// failure is older than the lockout.
+type LoginFailure struct {
+	Key          string    `gorm:"primaryKey"`
+	Failures     int       `gorm:"not null"`
+	LastFailedAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"-" gorm:"not null;index:idx_notifications_user_read"`
+	Kind      string     `json:"kind" gorm:"not null"`
+	Title     string     `json:"title" gorm:"not null"`
+	Body      string     `json:"body" gorm:"not null"`
+	TaskID    *uint      `json:"task_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty" gorm:"index:idx_notifications_user_read"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// OAuthClient is an application registered by a user to act on other
+// users' behalf through the authorization code flow. Confidential clients
+// authenticate with a secret, of which only a hash is stored; public
+// clients, such as native apps, have none and rely on PKCE alone.
+type OAuthClient struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	ClientID         string     `json:"client_id" gorm:"not null;uniqueIndex"`
+	ClientSecretHash string     `json:"-"`
+	UserID           uint       `json:"-" gorm:"not null;index"`
+	Name             string     `json:"name" gorm:"not null"`
+	RedirectURIs     StringList `json:"redirect_uris" gorm:"type:text;not null"`
+	// Scopes are the most the client may ask users for.
+	Scopes    StringList `json:"scopes" gorm:"type:text;not null"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Confidential reports whether the client has to authenticate with a
+// secret.
+func (c *OAuthClient) Confidential() bool {
+	return c.ClientSecretHash != ""
+}
+
+// OAuthAuthorizationCode is the short-lived code handed to a client after the
+// user consents. It is exchanged once, together with the PKCE verifier, for
+// a session with the granted scopes.
+type OAuthAuthorizationCode struct {
+	ID            uint       `gorm:"primaryKey"`
+	CodeHash      string     `gorm:"not null;uniqueIndex"`
+	ClientID      string     `gorm:"not null"`
+	UserID        uint       `gorm:"not null"`
+	RedirectURI   string     `gorm:"not null"`
+	Scopes        StringList `gorm:"type:text;not null"`
+	CodeChallenge string     `gorm:"not null"`
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	UsedAt        *time.Time
+	// SessionID is the session the code was exchanged for, revoked if the
+	// code is presented again.
+	SessionID *uint
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboxEmail is a rendered email waiting to be delivered over SMTP.
+type OutboxEmail struct {
+	ID            uint       `gorm:"primaryKey"`
+	To            string     `gorm:"not null"`
+	Subject       string     `gorm:"not null"`
+	TextBody      string     `gorm:"not null"`
+	HTMLBody      string     `gorm:"not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"not null;index"`
+	SentAt        *time.Time `gorm:"index"`
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
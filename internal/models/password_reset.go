@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordResetToken lets the holder of a link from a reset email set a new
+// password once. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of one rate limit key, shared by all
+// instances when rate limits are kept in the database.
+type RateLimitBucket struct {
+	Key        string    `gorm:"primaryKey"`
+	Tokens     float64   `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null"`
+	// FullAt is when the bucket will have refilled completely, after which
+	// it can be deleted.
+	FullAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RecoveryCode lets a user with two-factor authentication sign in once
+// without their authenticator. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
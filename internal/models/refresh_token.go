@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RefreshToken is an opaque, single-use token for obtaining a new access
+// token. Each use replaces it with a new token in the same family, which
+// starts at login. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;index"`
+	FamilyID     string    `gorm:"not null;index"`
+	TokenHash    string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	UsedAt       *time.Time
+	ReplacedByID *uint
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Reminder fires either at an absolute RemindAt or OffsetMinutes before the
+// task's due date. FireAt is the resolved time and is nil while a relative
+// reminder's task has no due date.
+type Reminder struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	TaskID        uint       `json:"task_id" gorm:"not null;index"`
+	Task          Task       `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	UserID        uint       `json:"-" gorm:"not null;index"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"`
+	OffsetMinutes *int       `json:"offset_minutes,omitempty"`
+	FireAt        *time.Time `json:"fire_at" gorm:"index"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	Attempts      int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil   *time.Time `json:"-"`
+	LastError     string     `json:"-"`
+	CreatedAt     time.Time  `json:"-"`
+	UpdatedAt     time.Time  `json:"-"`
+}
+
+// ResolveFireAt sets FireAt from RemindAt or from OffsetMinutes and dueAt.
+func (r *Reminder) ResolveFireAt(dueAt *time.Time) {
+	switch {
+	case r.RemindAt != nil:
+		r.FireAt = r.RemindAt
+	case r.OffsetMinutes != nil && dueAt != nil:
+		fireAt := dueAt.Add(-time.Duration(*r.OffsetMinutes) * time.Minute)
+		r.FireAt = &fireAt
+	default:
+		r.FireAt = nil
+	}
+}
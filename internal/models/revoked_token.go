@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken denies an access token, identified by its jti, until it
+// would have expired anyway. A JTI of "sid:<id>" denies every access token
+// issued for that session.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	JTI       string    `gorm:"column:jti;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is a login on one device. It lives as long as the refresh token
+// family started by the login, and LastSeenAt moves forward every time the
+// device refreshes its tokens. Sessions started by an OAuth client carry the
+// client's ID and the scopes the user granted it.
+type Session struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"-" gorm:"not null;index"`
+	RefreshFamilyID string     `json:"-" gorm:"not null;uniqueIndex"`
+	UserAgent       string     `json:"user_agent"`
+	IP              string     `json:"ip"`
+	ClientID        string     `json:"client_id,omitempty" gorm:"index"`
+	Scopes          StringList `json:"scopes,omitempty" gorm:"type:text"`
+	Current         bool       `json:"current" gorm:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastSeenAt      time.Time  `json:"last_seen_at"`
+	RevokedAt       *time.Time `json:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// SigningKey is an asymmetric key for signing access tokens. The newest key
+// past its ActiveAt signs new tokens. A rotated key is published in the JWKS
+// before its ActiveAt, so that verifiers have it by the time it signs.
+// Rotation gives the previous keys an ExpiresAt after which no token they
+// signed is still valid, and until then they keep verifying and stay
+// published in the JWKS.
+type SigningKey struct {
+	ID        uint   `gorm:"primaryKey"`
+	KID       string `gorm:"not null;uniqueIndex"`
+	Algorithm string `gorm:"not null"`
+	// PrivateKey is PKCS #8, PEM encoded.
+	PrivateKey string `gorm:"not null"`
+	CreatedAt  time.Time
+	// ActiveAt is when the key starts signing.
+	ActiveAt  time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP"`
+	ExpiresAt *time.Time `gorm:"index"`
+}
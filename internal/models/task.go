@@ -4,12 +4,27 @@ import (
 	"time"
 )
 
+// TaskSyncSequence numbers every task write and tombstone. A task's
+// SyncVersion is the sequence value of its latest write, so clients can ask
+// for everything changed after the highest version they have seen.
+const TaskSyncSequence = "task_sync_version_seq"
+
 type Task struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Title     string    `json:"title" gorm:"not null"`
-	Body      string    `json:"body" gorm:"not null"`
-	Completed bool      `json:"completed" gorm:"default:false"`
-	UserID    uint      `json:"-" gorm:"not null"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Title       string     `json:"title" gorm:"not null"`
+	Body        string     `json:"body" gorm:"not null"`
+	Completed   bool       `json:"completed" gorm:"default:false"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Priority    string     `json:"priority,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Tags        StringList `json:"tags,omitempty" gorm:"type:text"`
+	Checklist   Checklist  `json:"checklist,omitempty" gorm:"type:text"`
+	ParentID    *uint      `json:"parent_id,omitempty" gorm:"index"`
+	Subtasks    []Task     `json:"subtasks,omitempty" gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE"`
+	UserID      uint       `json:"-" gorm:"not null;index:idx_tasks_user_id_sync_version"`
+	Version     uint       `json:"version" gorm:"not null;default:1"`
+	SyncVersion uint64     `json:"sync_version" gorm:"not null;default:nextval('task_sync_version_seq');index:idx_tasks_user_id_sync_version"`
+	CreatedAt   time.Time  `json:"-"`
+	UpdatedAt   time.Time  `json:"-"`
 }
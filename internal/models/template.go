@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type TaskTemplate struct {
+	ID               uint               `json:"id" gorm:"primaryKey"`
+	Name             string             `json:"name" gorm:"not null"`
+	Title            string             `json:"title" gorm:"not null"`
+	Body             string             `json:"body" gorm:"not null"`
+	DueOffsetMinutes *int               `json:"due_offset_minutes,omitempty"`
+	Tags             StringList         `json:"tags,omitempty" gorm:"type:text"`
+	Checklist        StringList         `json:"checklist,omitempty" gorm:"type:text"`
+	Items            []TaskTemplateItem `json:"items" gorm:"foreignKey:TemplateID;constraint:OnDelete:CASCADE"`
+	UserID           uint               `json:"-" gorm:"not null;index"`
+	CreatedAt        time.Time          `json:"-"`
+	UpdatedAt        time.Time          `json:"-"`
+}
+
+type TaskTemplateItem struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	TemplateID       uint       `json:"-" gorm:"not null;index"`
+	Position         int        `json:"position" gorm:"not null"`
+	Title            string     `json:"title" gorm:"not null"`
+	Body             string     `json:"body" gorm:"not null"`
+	DueOffsetMinutes *int       `json:"due_offset_minutes,omitempty"`
+	Tags             StringList `json:"tags,omitempty" gorm:"type:text"`
+	Checklist        StringList `json:"checklist,omitempty" gorm:"type:text"`
+}
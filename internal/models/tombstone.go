@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TaskTombstone records a deleted task so offline clients learn about the
+// deletion on their next sync.
+type TaskTombstone struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	TaskID      uint      `json:"id" gorm:"not null"`
+	UserID      uint      `json:"-" gorm:"not null;index:idx_task_tombstones_user_id_sync_version"`
+	SyncVersion uint64    `json:"sync_version" gorm:"not null;default:nextval('task_sync_version_seq');index:idx_task_tombstones_user_id_sync_version"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
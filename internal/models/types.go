@@ -0,0 +1,64 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList is a list of strings stored as a JSON array in a text column.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	return string(b), err
+}
+
+func (l *StringList) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case []byte:
+		return json.Unmarshal(v, l)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+}
+
+// ChecklistItem is a step of a task that is ticked off on its own.
+type ChecklistItem struct {
+	Text string `json:"text" validate:"required"`
+	Done bool   `json:"done"`
+}
+
+// Checklist is a list of checklist items stored as a JSON array in a text
+// column.
+type Checklist []ChecklistItem
+
+func (c Checklist) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]ChecklistItem(c))
+	return string(b), err
+}
+
+func (c *Checklist) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return fmt.Errorf("cannot scan %T into Checklist", src)
+	}
+}
@@ -3,10 +3,43 @@ package models
 import "time"
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Tasks     []Task    `json:"tasks,omitempty" gorm:"foreignKey:UserID"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID               uint         `json:"id" gorm:"primaryKey"`
+	Username         string       `json:"username" gorm:"unique;not null"`
+	Email            *string      `json:"email,omitempty" gorm:"uniqueIndex"`
+	EmailVerifiedAt  *time.Time   `json:"email_verified_at,omitempty"`
+	Password         string       `json:"-" gorm:"not null"`
+	Timezone         string       `json:"timezone" gorm:"not null;default:UTC"`
+	DigestFrequency  string       `json:"digest_frequency" gorm:"not null;default:off"`
+	DigestTime       string       `json:"digest_time" gorm:"not null;default:08:00"`
+	DigestWeekday    time.Weekday `json:"digest_weekday" gorm:"not null;default:1" swaggertype:"integer"`
+	DigestLastSentAt *time.Time   `json:"-"`
+	TokenGeneration  uint         `json:"-" gorm:"not null;default:0"`
+	TOTPSecret       string       `json:"-"`
+	TOTPEnabledAt    *time.Time   `json:"totp_enabled_at,omitempty"`
+	TOTPCounter      int64        `json:"-" gorm:"not null;default:0"`
+	Tasks            []Task       `json:"tasks,omitempty" gorm:"foreignKey:UserID"`
+	CreatedAt        time.Time    `json:"-"`
+	UpdatedAt        time.Time    `json:"-"`
 }
+
+// VerifiedEmail returns the user's email address if it has been verified,
+// and "" otherwise. Notifications are only sent to verified addresses.
+func (u *User) VerifiedEmail() string {
+	if u.Email == nil || u.EmailVerifiedAt == nil {
+		return ""
+	}
+	return *u.Email
+}
+
+// MFAEnabled reports whether logging in requires a second factor.
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Digest frequencies. Digests are sent at DigestTime ("15:04") in the
+// user's timezone, and weekly ones on DigestWeekday.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
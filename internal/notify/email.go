@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"maps"
+	texttemplate "text/template"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// EmailNotifier renders notifications from templates/<kind>.txt and
+// templates/<kind>.html and queues them in the outbox. Messages without a
+// recipient address are skipped.
+type EmailNotifier struct {
+	store *storage.Storage
+}
+
+func NewEmailNotifier(store *storage.Storage) *EmailNotifier {
+	return &EmailNotifier{store: store}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, msg Message) error {
+	return n.NotifyTx(ctx, n.store, msg)
+}
+
+// NotifyTx queues the email in the outbox of tx.
+func (n *EmailNotifier) NotifyTx(ctx context.Context, tx *storage.Storage, msg Message) error {
+	if msg.To == "" {
+		return nil
+	}
+
+	email, err := Render(msg)
+	if err != nil {
+		return err
+	}
+
+	return tx.Outbox.EnqueueEmail(email)
+}
+
+// Render builds the email for msg without queueing it.
+func Render(msg Message) (*models.OutboxEmail, error) {
+	data := maps.Clone(msg.Data)
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["Subject"] = msg.Subject
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, msg.Kind+".txt", data); err != nil {
+		return nil, fmt.Errorf("render %s text template: %w", msg.Kind, err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, msg.Kind+".html", data); err != nil {
+		return nil, fmt.Errorf("render %s html template: %w", msg.Kind, err)
+	}
+
+	return &models.OutboxEmail{
+		To:       msg.To,
+		Subject:  msg.Subject,
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
@@ -0,0 +1,93 @@
+// Package notify delivers user-facing notifications such as task reminders.
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	KindReminder      = "reminder"
+	KindPasswordReset = "password_reset"
+	KindDigest        = "digest"
+	// KindEmailVerification is sent to an unverified address, so it sets To
+	// itself rather than using the user's verified email.
+	KindEmailVerification = "email_verification"
+)
+
+type Message struct {
+	UserID uint
+	// To is the recipient's email address. Email delivery is skipped when
+	// it is empty.
+	To      string
+	Kind    string
+	Subject string
+	Body    string
+	// Data carries kind-specific values for notifiers that render templates.
+	Data map[string]any
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// TxNotifier is implemented by notifiers that deliver by writing to the
+// database, so that a message can be written in the same transaction as
+// the change it is about.
+type TxNotifier interface {
+	NotifyTx(ctx context.Context, tx *storage.Storage, msg Message) error
+}
+
+// NotifyTx delivers msg through n within tx. Notifiers that do not write to
+// the database are called directly.
+func NotifyTx(ctx context.Context, n Notifier, tx *storage.Storage, msg Message) error {
+	if txn, ok := n.(TxNotifier); ok {
+		return txn.NotifyTx(ctx, tx, msg)
+	}
+	return n.Notify(ctx, msg)
+}
+
+// LogNotifier writes notifications to the log. It is the default notifier
+// when no delivery channel is configured.
+type LogNotifier struct {
+	log *slog.Logger
+}
+
+func NewLogNotifier(logger *slog.Logger) *LogNotifier {
+	return &LogNotifier{log: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.log.Info("notification",
+		slog.Uint64("user_id", uint64(msg.UserID)),
+		slog.String("kind", msg.Kind),
+		slog.String("subject", msg.Subject),
+	)
+	return nil
+}
+
+// Multi delivers a message through every notifier and joins their errors.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m Multi) NotifyTx(ctx context.Context, tx *storage.Storage, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := NotifyTx(ctx, n, tx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
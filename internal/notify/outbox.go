@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+const (
+	outboxLease       = 5 * time.Minute
+	outboxMaxAttempts = 8
+	outboxBatchSize   = 50
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 6 * time.Hour
+)
+
+type Sender interface {
+	Send(ctx context.Context, email *models.OutboxEmail) error
+}
+
+// OutboxWorker delivers queued emails, retrying failures with exponential
+// backoff. Emails that still fail after outboxMaxAttempts are left in the
+// outbox with their last error until they are pruned.
+type OutboxWorker struct {
+	store     *storage.Storage
+	sender    Sender
+	retention time.Duration
+	log       *slog.Logger
+}
+
+func NewOutboxWorker(store *storage.Storage, sender Sender, retention time.Duration, logger *slog.Logger) *OutboxWorker {
+	return &OutboxWorker{
+		store:     store,
+		sender:    sender,
+		retention: retention,
+		log:       logger,
+	}
+}
+
+// Prune deletes emails that were sent or given up on longer than the
+// retention ago.
+func (w *OutboxWorker) Prune(ctx context.Context) error {
+	return w.store.Outbox.PruneEmails(time.Now().Add(-w.retention), outboxMaxAttempts)
+}
+
+func (w *OutboxWorker) Run(ctx context.Context) error {
+	for {
+		emails, err := w.store.Outbox.ClaimDueEmails(time.Now(), outboxLease, outboxMaxAttempts, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, email := range emails {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err := w.sender.Send(ctx, &email); err != nil {
+				w.log.Error("failed to send email",
+					slog.Uint64("email_id", uint64(email.ID)),
+					slog.Int("attempt", email.Attempts),
+					slog.Any("error", err),
+				)
+				next := time.Now().Add(utils.Backoff(email.Attempts, outboxBaseBackoff, outboxMaxBackoff))
+				if err := w.store.Outbox.MarkEmailFailed(email.ID, err.Error(), next); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := w.store.Outbox.MarkEmailSent(email.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		if len(emails) < outboxBatchSize {
+			return nil
+		}
+	}
+}
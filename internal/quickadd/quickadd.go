@@ -0,0 +1,502 @@
+// Package quickadd parses free-form task descriptions such as
+// "Pay invoice tomorrow 5pm #finance !high every month" into task fields.
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Kind string
+
+const (
+	KindDate       Kind = "date"
+	KindTime       Kind = "time"
+	KindTag        Kind = "tag"
+	KindPriority   Kind = "priority"
+	KindRecurrence Kind = "recurrence"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+const (
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+	RecurrenceYearly  = "yearly"
+)
+
+// Due dates given without a time of day are due at the end of that day.
+const (
+	defaultDueHour   = 23
+	defaultDueMinute = 59
+)
+
+// Span is a recognised fragment of the input. Start and End are byte offsets
+// into the original text.
+type Span struct {
+	Kind       Kind    `json:"kind"`
+	Start      int     `json:"start"`
+	End        int     `json:"end"`
+	Text       string  `json:"text"`
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+type Result struct {
+	Title      string     `json:"title"`
+	DueAt      *time.Time `json:"due_at,omitempty"`
+	Tags       []string   `json:"tags"`
+	Priority   string     `json:"priority,omitempty"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	Spans      []Span     `json:"spans"`
+}
+
+type token struct {
+	text  string
+	lower string
+	start int
+	end   int
+}
+
+type clock struct {
+	hour   int
+	minute int
+}
+
+type parser struct {
+	text     string
+	now      time.Time
+	tokens   []token
+	consumed []bool
+
+	date     *time.Time
+	clock    *clock
+	absolute *time.Time
+
+	result Result
+}
+
+// Parse extracts task fields from text. Relative dates are resolved against
+// now, in now's location.
+func Parse(text string, now time.Time) Result {
+	p := &parser{text: text, now: now, tokens: tokenize(text)}
+	p.consumed = make([]bool, len(p.tokens))
+	p.result.Tags = []string{}
+	p.result.Spans = []Span{}
+
+	matchers := []func(i int) int{
+		p.matchTag,
+		p.matchPriority,
+		p.matchRecurrence,
+		p.matchRelative,
+		p.matchDate,
+		p.matchTime,
+	}
+
+	for i := 0; i < len(p.tokens); {
+		n := 0
+		for _, match := range matchers {
+			if n = match(i); n > 0 {
+				break
+			}
+		}
+		if n == 0 {
+			n = 1
+		}
+		i += n
+	}
+
+	var title []string
+	for i, t := range p.tokens {
+		if !p.consumed[i] {
+			title = append(title, t.text)
+		}
+	}
+	p.result.Title = strings.TrimSpace(strings.Join(title, " "))
+	p.result.DueAt = p.dueAt()
+
+	return p.result
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, newToken(s, start, i))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(s, start, len(s)))
+	}
+	return tokens
+}
+
+func newToken(s string, start, end int) token {
+	text := s[start:end]
+	return token{
+		text:  text,
+		lower: strings.ToLower(strings.TrimRight(text, ",.;:")),
+		start: start,
+		end:   end,
+	}
+}
+
+// word returns the normalised token at i, or "" when i is out of range or
+// the token has already been consumed.
+func (p *parser) word(i int) string {
+	if i < 0 || i >= len(p.tokens) || p.consumed[i] {
+		return ""
+	}
+	return p.tokens[i].lower
+}
+
+// accept marks n tokens starting at i as consumed and records a span for
+// them. Date-like spans also swallow a preceding connector such as "at" or
+// "on", so it does not end up in the title.
+func (p *parser) accept(i, n int, kind Kind, value string, confidence float64) int {
+	start := i
+	if kind == KindDate || kind == KindTime || kind == KindRecurrence {
+		switch p.word(i - 1) {
+		case "at", "on", "by", "due", "@":
+			start = i - 1
+		}
+	}
+
+	for j := start; j < i+n; j++ {
+		p.consumed[j] = true
+	}
+
+	from, to := p.tokens[start].start, p.tokens[i+n-1].end
+	text := strings.TrimRight(p.text[from:to], ",.;:")
+	p.result.Spans = append(p.result.Spans, Span{
+		Kind:       kind,
+		Start:      from,
+		End:        from + len(text),
+		Text:       text,
+		Value:      value,
+		Confidence: confidence,
+	})
+
+	return n
+}
+
+var tagPattern = regexp.MustCompile(`^#([\p{L}\p{N}_/-]+)$`)
+
+func (p *parser) matchTag(i int) int {
+	m := tagPattern.FindStringSubmatch(p.word(i))
+	if m == nil {
+		return 0
+	}
+	p.result.Tags = append(p.result.Tags, m[1])
+	return p.accept(i, 1, KindTag, m[1], 1)
+}
+
+var priorities = map[string]string{
+	"!low": PriorityLow, "!l": PriorityLow, "!4": PriorityLow,
+	"!medium": PriorityMedium, "!med": PriorityMedium, "!m": PriorityMedium, "!3": PriorityMedium,
+	"!high": PriorityHigh, "!h": PriorityHigh, "!2": PriorityHigh,
+	"!urgent": PriorityUrgent, "!u": PriorityUrgent, "!1": PriorityUrgent,
+}
+
+func (p *parser) matchPriority(i int) int {
+	priority, ok := priorities[p.word(i)]
+	if !ok {
+		return 0
+	}
+	p.result.Priority = priority
+	return p.accept(i, 1, KindPriority, priority, 1)
+}
+
+var recurrenceWords = map[string]string{
+	"daily": RecurrenceDaily, "weekly": RecurrenceWeekly,
+	"monthly": RecurrenceMonthly, "yearly": RecurrenceYearly, "annually": RecurrenceYearly,
+}
+
+var recurrenceUnits = map[string]string{
+	"day": RecurrenceDaily, "week": RecurrenceWeekly,
+	"month": RecurrenceMonthly, "year": RecurrenceYearly,
+}
+
+func (p *parser) matchRecurrence(i int) int {
+	if recurrence, ok := recurrenceWords[p.word(i)]; ok {
+		p.result.Recurrence = recurrence
+		return p.accept(i, 1, KindRecurrence, recurrence, 0.9)
+	}
+
+	if p.word(i) != "every" {
+		return 0
+	}
+
+	next := p.word(i + 1)
+	if recurrence, ok := recurrenceUnits[next]; ok {
+		p.result.Recurrence = recurrence
+		return p.accept(i, 2, KindRecurrence, recurrence, 1)
+	}
+
+	if weekday, ok := parseWeekday(strings.TrimSuffix(next, "s")); ok {
+		p.result.Recurrence = RecurrenceWeekly
+		if p.date == nil {
+			date := p.nextWeekday(weekday)
+			p.date = &date
+		}
+		return p.accept(i, 2, KindRecurrence, RecurrenceWeekly, 0.9)
+	}
+
+	return 0
+}
+
+var relativeUnits = map[string]time.Duration{
+	"min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+}
+
+func (p *parser) matchRelative(i int) int {
+	if p.word(i) != "in" {
+		return 0
+	}
+
+	amount, err := strconv.Atoi(p.word(i + 1))
+	if err != nil || amount <= 0 {
+		return 0
+	}
+
+	unit := p.word(i + 2)
+	if d, ok := relativeUnits[unit]; ok {
+		at := p.now.Add(time.Duration(amount) * d)
+		p.absolute = &at
+		return p.accept(i, 3, KindDate, at.Format(time.RFC3339), 1)
+	}
+
+	var date time.Time
+	switch strings.TrimSuffix(unit, "s") {
+	case "day":
+		date = p.today().AddDate(0, 0, amount)
+	case "week":
+		date = p.today().AddDate(0, 0, 7*amount)
+	case "month":
+		date = p.today().AddDate(0, amount, 0)
+	default:
+		return 0
+	}
+
+	p.date = &date
+	return p.accept(i, 3, KindDate, date.Format(time.DateOnly), 1)
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+func (p *parser) matchDate(i int) int {
+	word := p.word(i)
+	today := p.today()
+
+	setDate := func(date time.Time, n int, confidence float64) int {
+		p.date = &date
+		return p.accept(i, n, KindDate, date.Format(time.DateOnly), confidence)
+	}
+
+	switch word {
+	case "today":
+		return setDate(today, 1, 1)
+	case "tonight":
+		if p.clock == nil {
+			p.clock = &clock{hour: 20}
+		}
+		return setDate(today, 1, 0.9)
+	case "tomorrow", "tmr", "tmrw":
+		return setDate(today.AddDate(0, 0, 1), 1, 1)
+	case "next":
+		switch p.word(i + 1) {
+		case "week":
+			return setDate(p.nextWeekday(time.Monday), 2, 0.9)
+		case "month":
+			return setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), 2, 0.9)
+		}
+		if weekday, ok := parseWeekday(p.word(i + 1)); ok {
+			return setDate(p.nextWeekday(weekday), 2, 0.8)
+		}
+		return 0
+	}
+
+	if weekday, ok := parseWeekday(word); ok {
+		confidence := 1.0
+		if len(word) <= 3 {
+			confidence = 0.8
+		}
+		return setDate(p.nextWeekday(weekday), 1, confidence)
+	}
+
+	if date, err := time.ParseInLocation(time.DateOnly, word, p.now.Location()); err == nil {
+		return setDate(date, 1, 1)
+	}
+
+	// "oct 25" and "25 oct"
+	if month, ok := months[word]; ok {
+		if day, err := strconv.Atoi(p.word(i + 1)); err == nil {
+			if date, ok := p.upcomingDate(month, day); ok {
+				return setDate(date, 2, 0.9)
+			}
+		}
+	}
+	if day, err := strconv.Atoi(word); err == nil {
+		if month, ok := months[p.word(i+1)]; ok {
+			if date, ok := p.upcomingDate(month, day); ok {
+				return setDate(date, 2, 0.9)
+			}
+		}
+	}
+
+	return 0
+}
+
+var (
+	meridiemPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	clockPattern    = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+)
+
+func (p *parser) matchTime(i int) int {
+	word := p.word(i)
+
+	setClock := func(c clock, n int, confidence float64) int {
+		p.clock = &c
+		return p.accept(i, n, KindTime, time.Date(0, 1, 1, c.hour, c.minute, 0, 0, time.UTC).Format("15:04"), confidence)
+	}
+
+	switch word {
+	case "noon":
+		return setClock(clock{hour: 12}, 1, 1)
+	case "midnight":
+		return setClock(clock{hour: 0}, 1, 0.9)
+	}
+
+	n := 1
+	if next := p.word(i + 1); next == "am" || next == "pm" {
+		word += next
+		n = 2
+	}
+
+	if m := meridiemPattern.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+		return setClock(clock{hour: hour, minute: minute}, n, 0.9)
+	}
+
+	if m := clockPattern.FindStringSubmatch(p.word(i)); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return 0
+		}
+		return setClock(clock{hour: hour, minute: minute}, 1, 0.9)
+	}
+
+	return 0
+}
+
+func (p *parser) dueAt() *time.Time {
+	if p.absolute != nil {
+		return p.absolute
+	}
+	if p.date == nil && p.clock == nil {
+		return nil
+	}
+
+	date := p.today()
+	if p.date != nil {
+		date = *p.date
+	}
+
+	c := clock{hour: defaultDueHour, minute: defaultDueMinute}
+	if p.clock != nil {
+		c = *p.clock
+	}
+
+	due := time.Date(date.Year(), date.Month(), date.Day(), c.hour, c.minute, 0, 0, p.now.Location())
+
+	// A bare time that has already passed today means tomorrow.
+	if p.date == nil && due.Before(p.now) {
+		due = due.AddDate(0, 0, 1)
+	}
+
+	return &due
+}
+
+func (p *parser) today() time.Time {
+	y, m, d := p.now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, p.now.Location())
+}
+
+// nextWeekday returns the first date strictly after today that falls on
+// weekday.
+func (p *parser) nextWeekday(weekday time.Weekday) time.Time {
+	today := p.today()
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
+
+// upcomingDate returns the next occurrence of month/day, today included.
+func (p *parser) upcomingDate(month time.Month, day int) (time.Time, bool) {
+	today := p.today()
+	date := time.Date(today.Year(), month, day, 0, 0, 0, 0, today.Location())
+	if date.Month() != month {
+		return time.Time{}, false
+	}
+	if date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	weekday, ok := weekdays[s]
+	return weekday, ok
+}
@@ -0,0 +1,243 @@
+package quickadd
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2025, time.January, 15, 10, 0, 0, 0, time.UTC)
+	newYork := time.FixedZone("EST", -5*60*60)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	tests := []struct {
+		name       string
+		text       string
+		now        time.Time
+		title      string
+		due        string
+		tags       []string
+		priority   string
+		recurrence string
+	}{
+		{
+			name:       "everything",
+			text:       "Pay invoice tomorrow 5pm #finance !high every month",
+			title:      "Pay invoice",
+			due:        "2025-01-16T17:00:00Z",
+			tags:       []string{"finance"},
+			priority:   PriorityHigh,
+			recurrence: RecurrenceMonthly,
+		},
+		{
+			name:       "everything in the user's timezone",
+			text:       "Pay invoice tomorrow 5pm #finance !high every month",
+			now:        time.Date(2025, time.January, 15, 10, 0, 0, 0, newYork),
+			title:      "Pay invoice",
+			due:        "2025-01-16T22:00:00Z",
+			tags:       []string{"finance"},
+			priority:   PriorityHigh,
+			recurrence: RecurrenceMonthly,
+		},
+		{
+			// 23:30 in Tokyo is 14:30 UTC, the same day: "tomorrow" is
+			// the next day in Tokyo, not in UTC.
+			name:  "day boundary in the user's timezone",
+			text:  "Call 9am tomorrow",
+			now:   time.Date(2025, time.January, 15, 23, 30, 0, 0, tokyo),
+			title: "Call",
+			due:   "2025-01-16T00:00:00Z",
+		},
+		{
+			name:  "passed time in the user's timezone",
+			text:  "Call 9am",
+			now:   time.Date(2025, time.January, 15, 23, 30, 0, 0, tokyo),
+			title: "Call",
+			due:   "2025-01-16T00:00:00Z",
+		},
+		{
+			name:  "nothing to parse",
+			text:  "Buy milk",
+			title: "Buy milk",
+		},
+		{
+			name:  "empty",
+			text:  "",
+			title: "",
+		},
+		{
+			name:  "today ends the day",
+			text:  "Call mom today",
+			title: "Call mom",
+			due:   "2025-01-15T23:59:00Z",
+		},
+		{
+			name:  "connector goes with the date",
+			text:  "Meet Ann at 3pm tomorrow",
+			title: "Meet Ann",
+			due:   "2025-01-16T15:00:00Z",
+		},
+		{
+			name:  "in days",
+			text:  "Send report in 3 days",
+			title: "Send report",
+			due:   "2025-01-18T23:59:00Z",
+		},
+		{
+			name:  "in minutes",
+			text:  "Stretch in 30 minutes",
+			title: "Stretch",
+			due:   "2025-01-15T10:30:00Z",
+		},
+		{
+			name:  "weekday later this week",
+			text:  "Standup friday 9:30",
+			title: "Standup",
+			due:   "2025-01-17T09:30:00Z",
+		},
+		{
+			name:  "same weekday rolls over a week",
+			text:  "Review wednesday",
+			title: "Review",
+			due:   "2025-01-22T23:59:00Z",
+		},
+		{
+			name:  "earlier weekday rolls over to next week",
+			text:  "Plan mon",
+			title: "Plan",
+			due:   "2025-01-20T23:59:00Z",
+		},
+		{
+			name:  "weekday rolls over the year",
+			text:  "Party friday",
+			now:   time.Date(2025, time.December, 30, 10, 0, 0, 0, time.UTC),
+			title: "Party",
+			due:   "2026-01-02T23:59:00Z",
+		},
+		{
+			name:  "next week is monday",
+			text:  "Dentist next week",
+			title: "Dentist",
+			due:   "2025-01-20T23:59:00Z",
+		},
+		{
+			name:  "passed time means tomorrow",
+			text:  "Lunch 9am",
+			title: "Lunch",
+			due:   "2025-01-16T09:00:00Z",
+		},
+		{
+			name:  "passed date means next year",
+			text:  "Renew lease jan 10",
+			title: "Renew lease",
+			due:   "2026-01-10T23:59:00Z",
+		},
+		{
+			name:  "upcoming date",
+			text:  "Renew passport 1 dec",
+			title: "Renew passport",
+			due:   "2025-12-01T23:59:00Z",
+		},
+		{
+			name:       "recurring weekday",
+			text:       "Gym every monday",
+			title:      "Gym",
+			due:        "2025-01-20T23:59:00Z",
+			recurrence: RecurrenceWeekly,
+		},
+		{
+			name:       "recurrence word",
+			text:       "Water plants weekly",
+			title:      "Water plants",
+			recurrence: RecurrenceWeekly,
+		},
+		{
+			name:  "several tags",
+			text:  "#home Fix sink #plumbing/urgent",
+			title: "Fix sink",
+			tags:  []string{"home", "plumbing/urgent"},
+		},
+		{
+			name:  "hash inside a word is not a tag",
+			text:  "Learn C# basics",
+			title: "Learn C# basics",
+		},
+		{
+			name:     "numeric priority",
+			text:     "Fix outage !1",
+			title:    "Fix outage",
+			priority: PriorityUrgent,
+		},
+		{
+			name:  "unknown priority stays in the title",
+			text:  "Wow !amazing",
+			title: "Wow !amazing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := now
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+
+			got := Parse(tt.text, at)
+
+			if got.Title != tt.title {
+				t.Errorf("title = %q, want %q", got.Title, tt.title)
+			}
+
+			switch {
+			case tt.due == "" && got.DueAt != nil:
+				t.Errorf("due = %s, want none", got.DueAt.Format(time.RFC3339))
+			case tt.due != "" && got.DueAt == nil:
+				t.Errorf("due = none, want %s", tt.due)
+			case tt.due != "":
+				want, err := time.Parse(time.RFC3339, tt.due)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.DueAt.Equal(want) {
+					t.Errorf("due = %s, want %s", got.DueAt.Format(time.RFC3339), tt.due)
+				}
+				if got.DueAt.Location() != at.Location() {
+					t.Errorf("due is in %s, want %s", got.DueAt.Location(), at.Location())
+				}
+			}
+
+			tags := tt.tags
+			if tags == nil {
+				tags = []string{}
+			}
+			if !slices.Equal(got.Tags, tags) {
+				t.Errorf("tags = %q, want %q", got.Tags, tags)
+			}
+
+			if got.Priority != tt.priority {
+				t.Errorf("priority = %q, want %q", got.Priority, tt.priority)
+			}
+
+			if got.Recurrence != tt.recurrence {
+				t.Errorf("recurrence = %q, want %q", got.Recurrence, tt.recurrence)
+			}
+		})
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	text := "Pay invoice tomorrow #finance"
+	got := Parse(text, time.Date(2025, time.January, 15, 10, 0, 0, 0, time.UTC))
+
+	if len(got.Spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(got.Spans))
+	}
+
+	for _, span := range got.Spans {
+		if text[span.Start:span.End] != span.Text {
+			t.Errorf("span %q does not match the text at %d:%d", span.Text, span.Start, span.End)
+		}
+	}
+}
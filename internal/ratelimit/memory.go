@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+)
+
+// MemoryStore keeps buckets in memory. Each instance counts on its own, so
+// with several instances a client gets each limit once per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*models.RateLimitBucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*models.RateLimitBucket{},
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &models.RateLimitBucket{Key: key}
+		s.buckets[key] = bucket
+	}
+
+	return take(bucket, limit, time.Now()), nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, bucket := range s.buckets {
+		if bucket.FullAt.Before(now) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps buckets in the database, so that all instances share
+// them. Each request locks its bucket's row for the duration of one short
+// transaction.
+type PostgresStore struct {
+	store *storage.Storage
+}
+
+func NewPostgresStore(store *storage.Storage) *PostgresStore {
+	return &PostgresStore{store: store}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var result Result
+	err := s.store.Transaction(func(tx *storage.Storage) error {
+		bucket, err := tx.RateLimits.GetBucketForUpdate(key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bucket = &models.RateLimitBucket{Key: key}
+		} else if err != nil {
+			return err
+		}
+
+		result = take(bucket, limit, time.Now())
+		return tx.RateLimits.SaveBucket(bucket)
+	})
+
+	return result, err
+}
+
+func (s *PostgresStore) Prune(ctx context.Context) error {
+	return s.store.RateLimits.PruneBuckets(time.Now())
+}
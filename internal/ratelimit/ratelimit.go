@@ -0,0 +1,112 @@
+// Package ratelimit limits how often a key, such as a user or an address,
+// may make requests, using token buckets kept in memory or in the database.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+)
+
+// Limit allows Requests requests at once, refilled evenly over Period. The
+// zero Limit allows everything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit written as "requests/period", such as "20/1m".
+// An empty string is the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q is not requests/period", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid number of requests", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// MustParseLimit is like ParseLimit but panics on an invalid limit.
+func MustParseLimit(s string) Limit {
+	limit, err := ParseLimit(s)
+	if err != nil {
+		panic(err)
+	}
+	return limit
+}
+
+// Unlimited reports whether l is the zero Limit.
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+// rate is how many tokens are refilled per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, if none was left.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets.
+type Store interface {
+	// Take takes a token from the bucket of key.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Prune forgets buckets that have refilled completely.
+	Prune(ctx context.Context) error
+}
+
+// take refills bucket for the time since it was last used, then takes a
+// token from it if there is one. A new bucket starts full.
+func take(bucket *models.RateLimitBucket, limit Limit, now time.Time) Result {
+	burst, rate := float64(limit.Requests), limit.rate()
+
+	if bucket.RefilledAt.IsZero() {
+		bucket.Tokens = burst
+	} else {
+		bucket.Tokens = min(burst, bucket.Tokens+now.Sub(bucket.RefilledAt).Seconds()*rate)
+	}
+	bucket.RefilledAt = now
+
+	result := Result{Allowed: bucket.Tokens >= 1}
+	if result.Allowed {
+		bucket.Tokens--
+	} else {
+		result.RetryAfter = seconds((1 - bucket.Tokens) / rate)
+	}
+
+	result.Remaining = int(bucket.Tokens)
+	result.Reset = seconds((burst - bucket.Tokens) / rate)
+	bucket.FullAt = now.Add(result.Reset)
+
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
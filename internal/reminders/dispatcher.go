@@ -0,0 +1,129 @@
+// Package reminders fires due task reminders through a notify.Notifier,
+// within the transaction that marks them sent where the notifier allows.
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/storage"
+)
+
+const (
+	// lease is how long a claimed reminder is reserved for this instance.
+	// A reminder whose delivery did not finish in time is retried.
+	lease       = 2 * time.Minute
+	maxAttempts = 5
+	batchSize   = 100
+	retryDelay  = time.Minute
+)
+
+type Dispatcher struct {
+	store    *storage.Storage
+	notifier notify.Notifier
+	log      *slog.Logger
+}
+
+func NewDispatcher(store *storage.Storage, notifier notify.Notifier, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		notifier: notifier,
+		log:      logger,
+	}
+}
+
+// errLeaseLost is returned when a reminder was claimed by another
+// instance or rescheduled while it was being delivered.
+var errLeaseLost = errors.New("reminder lease was lost")
+
+// Run delivers all reminders that are due. It is meant to be called
+// periodically by the scheduler.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		reminders, err := d.store.Reminders.ClaimDueReminders(time.Now(), lease, maxAttempts, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, reminder := range reminders {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err := d.deliver(ctx, &reminder)
+			if errors.Is(err, errLeaseLost) {
+				d.log.Warn("reminder changed while being delivered", slog.Uint64("reminder_id", uint64(reminder.ID)))
+				continue
+			}
+			if err != nil {
+				d.log.Error("failed to deliver reminder", slog.Uint64("reminder_id", uint64(reminder.ID)), slog.Any("error", err))
+				retryAt := time.Now().Add(retryDelay * time.Duration(reminder.Attempts))
+				if err := d.store.Reminders.MarkReminderFailed(&reminder, err.Error(), retryAt); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(reminders) < batchSize {
+			return nil
+		}
+	}
+}
+
+// deliver notifies the user of a claimed reminder. The email is queued and
+// the inbox entry written in the same transaction that marks the reminder
+// sent, so each is created exactly once, and not at all if the claim was
+// lost.
+func (d *Dispatcher) deliver(ctx context.Context, reminder *models.Reminder) error {
+	task, err := d.store.Tasks.GetTask(reminder.TaskID)
+	if err != nil {
+		return err
+	}
+
+	user, err := d.store.Users.GetUser(reminder.UserID)
+	if err != nil {
+		return err
+	}
+
+	msg := notify.Message{
+		UserID:  reminder.UserID,
+		To:      user.VerifiedEmail(),
+		Kind:    notify.KindReminder,
+		Subject: fmt.Sprintf("Reminder: %s", task.Title),
+		Body:    task.Body,
+		Data: map[string]any{
+			"TaskID": task.ID,
+			"Title":  task.Title,
+			"Body":   task.Body,
+			"DueAt":  task.DueAt,
+		},
+	}
+
+	return d.store.Transaction(func(tx *storage.Storage) error {
+		marked, err := tx.Reminders.MarkReminderSent(reminder, time.Now())
+		if err != nil {
+			return err
+		}
+		if !marked {
+			return errLeaseLost
+		}
+
+		err = tx.Notifications.CreateNotification(&models.Notification{
+			UserID: reminder.UserID,
+			Kind:   notify.KindReminder,
+			Title:  msg.Subject,
+			Body:   msg.Body,
+			TaskID: &task.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return notify.NotifyTx(ctx, d.notifier, tx, msg)
+	})
+}
@@ -48,10 +48,39 @@ func Unauthorized(w http.ResponseWriter, message string) error {
 	return WriteResponse(w, http.StatusUnauthorized, nil, message, false)
 }
 
+func Forbidden(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusForbidden, nil, message, false)
+}
+
 func NoContent(w http.ResponseWriter) error {
 	return WriteResponse(w, http.StatusNoContent, nil, "", true)
 }
 
+// NotModified writes a 304 response, which must not have a body.
+func NotModified(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotModified)
+}
+
+func Conflict(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusConflict, nil, message, false)
+}
+
+func UnprocessableEntity(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusUnprocessableEntity, nil, message, false)
+}
+
+func PreconditionFailed(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusPreconditionFailed, nil, message, false)
+}
+
+func PreconditionRequired(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusPreconditionRequired, nil, message, false)
+}
+
+func TooManyRequests(w http.ResponseWriter, message string) error {
+	return WriteResponse(w, http.StatusTooManyRequests, nil, message, false)
+}
+
 type Error struct {
 	Field  string   `json:"field"`
 	Errors []string `json:"errors"`
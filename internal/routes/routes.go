@@ -3,20 +3,28 @@ package routes
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/k1ender/task-master-go/docs"
+	"github.com/k1ender/task-master-go/internal/auth"
 	"github.com/k1ender/task-master-go/internal/config"
+	"github.com/k1ender/task-master-go/internal/events"
 	"github.com/k1ender/task-master-go/internal/handlers"
 	"github.com/k1ender/task-master-go/internal/middleware"
+	"github.com/k1ender/task-master-go/internal/notify"
+	"github.com/k1ender/task-master-go/internal/oidc"
+	"github.com/k1ender/task-master-go/internal/ratelimit"
 	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
 	"gorm.io/gorm"
 )
 
-func New(db *gorm.DB, config *config.Config, store *storage.Storage, logger *slog.Logger) *chi.Mux {
+func New(db *gorm.DB, config *config.Config, store *storage.Storage, broker *events.Broker, denylist *auth.Denylist, keys *auth.KeySet, passwords *auth.Passwords, limiter ratelimit.Store, notifier notify.Notifier, logger *slog.Logger) *chi.Mux {
 	r := chi.NewRouter()
 
 	docs.SwaggerInfo.Host = fmt.Sprintf("localhost:%s", config.HttpServer.Port)
@@ -25,13 +33,40 @@ func New(db *gorm.DB, config *config.Config, store *storage.Storage, logger *slo
 	docs.SwaggerInfo.Version = "1.0"
 
 	validator := validator.New(validator.WithRequiredStructEnabled())
+	validator.RegisterValidation("username", utils.ValidateUsername)
 
-	userHandlers := handlers.NewUserHandler(store, validator, config, logger)
-	authHandlers := handlers.NewAuthHandler(store, validator, config, logger)
+	userHandlers := handlers.NewUserHandler(store, notifier, validator, config, logger)
+	authHandlers := handlers.NewAuthHandler(store, denylist, keys, passwords, notifier, validator, config, logger)
 	taskHandlers := handlers.NewTaskHandler(store, validator, config, logger)
+	templateHandlers := handlers.NewTemplateHandler(store, validator, config, logger)
+	reminderHandlers := handlers.NewReminderHandler(store, validator, config, logger)
+	notificationHandlers := handlers.NewNotificationHandler(store, validator, config, logger)
+	webhookHandlers := handlers.NewWebhookHandler(store, validator, config, logger)
+	authenticator := middleware.NewAuthenticator(db, keys, denylist)
+	eventHandlers := handlers.NewEventHandler(store, broker, authenticator, config, logger)
+	socketHandlers := handlers.NewSocketHandler(r, store, broker, authenticator, config, logger)
+	syncHandlers := handlers.NewSyncHandler(store, validator, config, logger)
+	sessionHandlers := handlers.NewSessionHandler(store, denylist, config, logger)
+	mfaHandlers := handlers.NewMFAHandler(store, passwords, validator, config, logger)
+	passwordHandlers := handlers.NewPasswordHandler(store, denylist, passwords, notifier, validator, config, logger)
+	accessTokenHandlers := handlers.NewAccessTokenHandler(store, validator, config, logger)
+	jwksHandlers := handlers.NewJWKSHandler(keys, logger)
+	oauthHandlers := handlers.NewOAuthHandler(store, denylist, keys, passwords, config, logger)
+	oauthClientHandlers := handlers.NewOAuthClientHandler(store, denylist, validator, config, logger)
 
-	authMiddleware := middleware.Auth(db, config.JWT.Secret)
+	idempotency := middleware.Idempotency(store.Idempotency, config.Idempotency.TTL, logger)
+	authenticate := middleware.Auth(db, keys, denylist)
+	authLimit := middleware.RateLimit(limiter, "auth", ratelimit.MustParseLimit(config.RateLimit.Auth), logger)
+	apiLimit := middleware.RateLimit(limiter, "api", ratelimit.MustParseLimit(config.RateLimit.API), logger)
+	// Idempotency keys are checked and requests counted after
+	// authentication, so both are scoped to the user.
+	authMiddleware := func(h http.Handler) http.Handler {
+		return authenticate(apiLimit(idempotency(h)))
+	}
 	taskMiddleware := middleware.TaskMiddleware(db)
+	templateMiddleware := middleware.TemplateMiddleware(db)
+	webhookMiddleware := middleware.WebhookMiddleware(db)
+	verifiedEmail := middleware.RequireVerifiedEmail(config.Auth.RequireVerifiedEmail)
 
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL(
@@ -42,26 +77,134 @@ func New(db *gorm.DB, config *config.Config, store *storage.Storage, logger *slo
 		),
 	))
 
-	r.Post("/register",
+	r.Get("/.well-known/jwks.json", jwksHandlers.GetJWKS)
+	// Requests before login do not use Idempotency-Key: there is no user to
+	// scope keys to, and their responses carry credentials.
+	r.With(authLimit, middleware.NoStore).Post("/register",
 		authHandlers.RegisterUser,
 	)
-	r.Post("/login",
+	r.With(authLimit, middleware.NoStore).Post("/login",
 		authHandlers.LoginUser,
 	)
+	r.With(authLimit, middleware.NoStore).Post("/login/mfa", authHandlers.LoginMFA)
+	if config.OIDC.Issuer != "" {
+		oidcConfig := config.OIDC
+		if oidcConfig.RedirectURL == "" {
+			oidcConfig.RedirectURL = config.HttpServer.PublicURL + "/login/oidc/callback"
+		}
+		provider := oidc.New(oidcConfig, &http.Client{Timeout: 10 * time.Second})
+		oidcHandlers := handlers.NewOIDCHandler(store, keys, passwords, provider, config, logger)
+
+		r.With(authLimit).Get("/login/oidc", oidcHandlers.Login)
+		r.With(authLimit, middleware.NoStore).Get("/login/oidc/callback", oidcHandlers.Callback)
+	}
+	r.With(authLimit, middleware.NoStore).Post("/token/refresh", authHandlers.RefreshToken)
+	r.With(authLimit).Post("/password/forgot", passwordHandlers.ForgotPassword)
+	r.With(authLimit).Get("/password/reset", passwordHandlers.ResetPasswordPage)
+	r.With(authLimit).Post("/password/reset", passwordHandlers.ResetPassword)
+	r.With(authLimit).Get("/email/verify", userHandlers.VerifyEmailPage)
+	r.With(authLimit).Post("/email/verify", userHandlers.VerifyEmailLink)
+	r.With(authMiddleware).Post("/logout", authHandlers.Logout)
+	r.With(authMiddleware, middleware.RequireScope(auth.ScopeUserWrite)).Post("/logout/all", authHandlers.LogoutAll)
+	r.With(authLimit).Get("/digest/unsubscribe", userHandlers.UnsubscribeDigestPage)
+	r.With(authLimit).Post("/digest/unsubscribe", userHandlers.UnsubscribeDigest)
 	r.Route("/user", func(r chi.Router) {
-		r.Use(authMiddleware)
+		r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeUserRead, auth.ScopeUserWrite))
 		r.Get("/", userHandlers.GetUser)
+		r.Patch("/", userHandlers.UpdateUser)
+		r.With(verifiedEmail).Put("/digest", userHandlers.UpdateDigest)
+		r.Put("/email", userHandlers.UpdateEmail)
+		r.Post("/email/verify", userHandlers.VerifyEmail)
+		r.Put("/password", passwordHandlers.ChangePassword)
+		// The TOTP secret, recovery codes and new tokens are shown once and
+		// must not be kept for idempotent replay.
+		r.With(middleware.NoStore).Post("/mfa/totp", mfaHandlers.EnrollTOTP)
+		r.With(middleware.NoStore).Post("/mfa/totp/confirm", mfaHandlers.ConfirmTOTP)
+		r.Post("/mfa/totp/disable", mfaHandlers.DisableTOTP)
+		r.With(middleware.NoStore).Post("/mfa/recovery-codes", mfaHandlers.RegenerateRecoveryCodes)
+		r.Get("/sessions", sessionHandlers.GetSessions)
+		r.Delete("/sessions/{id}", sessionHandlers.DeleteSession)
+		r.Get("/tokens", accessTokenHandlers.GetAccessTokens)
+		r.With(middleware.NoStore).Post("/tokens", accessTokenHandlers.CreateAccessToken)
+		r.Delete("/tokens/{id}", accessTokenHandlers.DeleteAccessToken)
+	})
+
+	// The OAuth endpoints take form posts from browsers and clients, answer
+	// in the formats of RFC 6749, and do not use Idempotency-Key.
+	r.Route("/oauth", func(r chi.Router) {
+		r.With(authLimit).Get("/authorize", oauthHandlers.Authorize)
+		r.With(authLimit).Post("/authorize", oauthHandlers.Approve)
+		r.With(authLimit).Post("/token", oauthHandlers.Token)
+		r.With(authLimit).Post("/revoke", oauthHandlers.Revoke)
+		r.With(authLimit).Post("/introspect", oauthHandlers.Introspect)
+		r.Route("/clients", func(r chi.Router) {
+			r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeUserRead, auth.ScopeUserWrite))
+			r.Get("/", oauthClientHandlers.GetClients)
+			r.With(middleware.NoStore).Post("/", oauthClientHandlers.CreateClient)
+			r.Delete("/{id}", oauthClientHandlers.DeleteClient)
+		})
 	})
 
 	r.Route("/tasks", func(r chi.Router) {
-		r.Use(authMiddleware)
+		r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeTasksRead, auth.ScopeTasksWrite))
 		r.Get("/", taskHandlers.GetTasks)
 		r.Post("/", taskHandlers.CreateTask)
+		r.Post("/quick", taskHandlers.QuickAddTask)
 		r.Route("/{id}", func(r chi.Router) {
 			r.Use(taskMiddleware)
-			r.Get("/", taskHandlers.GetTask)
-			r.Delete("/", taskHandlers.DeleteTask)
-			r.Patch("/", taskHandlers.UpdateTask)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.TaskPreconditions(config.HttpServer.RequireIfMatch))
+				r.Get("/", taskHandlers.GetTask)
+				r.Delete("/", taskHandlers.DeleteTask)
+				r.Patch("/", taskHandlers.UpdateTask)
+			})
+			r.Get("/reminders", reminderHandlers.GetReminders)
+			r.Post("/reminders", reminderHandlers.CreateReminder)
+			r.Delete("/reminders/{reminderID}", reminderHandlers.DeleteReminder)
+		})
+	})
+
+	r.Route("/templates", func(r chi.Router) {
+		r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeTemplatesRead, auth.ScopeTemplatesWrite))
+		r.Get("/", templateHandlers.GetTemplates)
+		r.Post("/", templateHandlers.CreateTemplate)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(templateMiddleware)
+			r.Get("/", templateHandlers.GetTemplate)
+			r.Delete("/", templateHandlers.DeleteTemplate)
+			r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Post("/instantiate", templateHandlers.InstantiateTemplate)
+		})
+	})
+
+	r.Route("/notifications", func(r chi.Router) {
+		r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeNotificationsRead, auth.ScopeNotificationsWrite))
+		r.Get("/", notificationHandlers.GetNotifications)
+		r.Post("/read-all", notificationHandlers.MarkAllRead)
+		r.Post("/{id}/read", notificationHandlers.MarkRead)
+	})
+
+	r.Route("/sync", func(r chi.Router) {
+		r.Use(authMiddleware, middleware.RequireScopeByMethod(auth.ScopeTasksRead, auth.ScopeTasksWrite))
+		r.Get("/", syncHandlers.GetChanges)
+		r.Post("/", syncHandlers.PushChanges)
+	})
+
+	r.With(authMiddleware, middleware.RequireScope(auth.ScopeTasksRead)).Get("/events", eventHandlers.StreamEvents)
+	// Requests made over the socket go through the routes above, which check
+	// their scopes.
+	r.With(middleware.TokenFromQuery("access_token"), authMiddleware, middleware.RequireScope(auth.ScopeTasksRead)).Get("/ws", socketHandlers.Serve)
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(authMiddleware, middleware.RequireScope(auth.ScopeWebhooksAdmin), verifiedEmail)
+		r.Get("/", webhookHandlers.GetWebhooks)
+		r.Post("/", webhookHandlers.CreateWebhook)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(webhookMiddleware)
+			r.Get("/", webhookHandlers.GetWebhook)
+			r.Patch("/", webhookHandlers.UpdateWebhook)
+			r.Delete("/", webhookHandlers.DeleteWebhook)
+			r.Get("/deliveries", webhookHandlers.GetDeliveries)
+			r.Post("/deliveries/{deliveryID}/redeliver", webhookHandlers.Redeliver)
 		})
 	})
 
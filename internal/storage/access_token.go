@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type AccessTokenStore interface {
+	CreateAccessToken(token *models.PersonalAccessToken) error
+	GetAccessToken(id uint) (*models.PersonalAccessToken, error)
+	GetAccessTokens(userID uint) ([]models.PersonalAccessToken, error)
+	DeleteAccessToken(id uint) error
+}
+
+type AccessTokenStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenStore(db *gorm.DB) AccessTokenStore {
+	return &AccessTokenStoreGorm{db: db}
+}
+
+func (s *AccessTokenStoreGorm) CreateAccessToken(token *models.PersonalAccessToken) error {
+	return s.db.Create(token).Error
+}
+
+func (s *AccessTokenStoreGorm) GetAccessToken(id uint) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	return &token, s.db.First(&token, id).Error
+}
+
+func (s *AccessTokenStoreGorm) GetAccessTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	return tokens, s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+}
+
+func (s *AccessTokenStoreGorm) DeleteAccessToken(id uint) error {
+	return s.db.Delete(&models.PersonalAccessToken{}, id).Error
+}
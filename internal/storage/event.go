@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+// EventsChannel is the PostgreSQL NOTIFY channel on which new events are
+// announced. The notification payload is "<event id>:<user id>".
+const EventsChannel = "task_master_events"
+
+type EventStore interface {
+	AppendEvent(event *models.Event) error
+	GetEvent(id uint64) (*models.Event, error)
+	GetEventsSince(userID uint, afterID uint64, limit int) ([]models.Event, error)
+	OldestEventID() (uint64, error)
+	PruneEvents(before time.Time) error
+}
+
+type EventStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewEventStore(db *gorm.DB) EventStore {
+	return &EventStoreGorm{db: db}
+}
+
+// AppendEvent stores event and notifies listeners. When called inside a
+// transaction the notification is only delivered once it commits.
+func (s *EventStoreGorm) AppendEvent(event *models.Event) error {
+	if err := s.db.Create(event).Error; err != nil {
+		return err
+	}
+
+	return s.db.Exec("SELECT pg_notify(?, ?)", EventsChannel, fmt.Sprintf("%d:%d", event.ID, event.UserID)).Error
+}
+
+func (s *EventStoreGorm) GetEvent(id uint64) (*models.Event, error) {
+	var event models.Event
+	return &event, s.db.First(&event, id).Error
+}
+
+func (s *EventStoreGorm) GetEventsSince(userID uint, afterID uint64, limit int) ([]models.Event, error) {
+	var events []models.Event
+	return events, s.db.
+		Where("user_id = ? AND id > ?", userID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+}
+
+// OldestEventID returns the smallest retained event ID, or 0 if the log is empty.
+func (s *EventStoreGorm) OldestEventID() (uint64, error) {
+	var id uint64
+	return id, s.db.Model(&models.Event{}).Select("COALESCE(MIN(id), 0)").Scan(&id).Error
+}
+
+func (s *EventStoreGorm) PruneEvents(before time.Time) error {
+	return s.db.Where("created_at < ?", before).Delete(&models.Event{}).Error
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyStore interface {
+	ReserveKey(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	CompleteKey(key *models.IdempotencyKey, expiresAt time.Time) error
+	ReleaseKey(key *models.IdempotencyKey) error
+	PruneKeys(now time.Time) error
+}
+
+type IdempotencyStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyStore(db *gorm.DB) IdempotencyStore {
+	return &IdempotencyStoreGorm{db: db}
+}
+
+// ReserveKey claims key for a new request. If the key is already taken it
+// returns the existing record and false instead. Expired records, including
+// abandoned reservations, are replaced.
+func (s *IdempotencyStoreGorm) ReserveKey(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	err := s.db.
+		Where("scope = ? AND key = ? AND expires_at < ?", key.Scope, key.Key, time.Now()).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return key, true, nil
+	}
+
+	var existing models.IdempotencyKey
+	err = s.db.Where("scope = ? AND key = ?", key.Scope, key.Key).First(&existing).Error
+	return &existing, false, err
+}
+
+// CompleteKey stores the response recorded on key and keeps it until
+// expiresAt.
+func (s *IdempotencyStoreGorm) CompleteKey(key *models.IdempotencyKey, expiresAt time.Time) error {
+	return s.db.Model(key).Updates(map[string]any{
+		"completed":    true,
+		"status":       key.Status,
+		"content_type": key.ContentType,
+		"body":         key.Body,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+// ReleaseKey drops a reservation so the request can be retried.
+func (s *IdempotencyStoreGorm) ReleaseKey(key *models.IdempotencyKey) error {
+	return s.db.Delete(key).Error
+}
+
+func (s *IdempotencyStoreGorm) PruneKeys(now time.Time) error {
+	return s.db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginFailureStore interface {
+	GetLoginFailures(keys []string) ([]models.LoginFailure, error)
+	RecordLoginFailure(key string, now, resetBefore time.Time) (int, error)
+	ReleaseLoginFailure(key string) error
+	ClearLoginFailures(key string) error
+	PruneLoginFailures(before time.Time) error
+}
+
+type LoginFailureStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewLoginFailureStore(db *gorm.DB) LoginFailureStore {
+	return &LoginFailureStoreGorm{db: db}
+}
+
+func (s *LoginFailureStoreGorm) GetLoginFailures(keys []string) ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	return failures, s.db.Where("key IN ?", keys).Find(&failures).Error
+}
+
+// RecordLoginFailure counts a failure for key and returns the new count.
+// A count whose last failure is before resetBefore starts over at one. The
+// increment is a single statement, so concurrent calls get distinct counts.
+func (s *LoginFailureStoreGorm) RecordLoginFailure(key string, now, resetBefore time.Time) (int, error) {
+	failure := models.LoginFailure{
+		Key:          key,
+		Failures:     1,
+		LastFailedAt: now,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"failures":       gorm.Expr("CASE WHEN login_failures.last_failed_at < ? THEN 1 ELSE login_failures.failures + 1 END", resetBefore),
+			"last_failed_at": now,
+		}),
+	}, clause.Returning{Columns: []clause.Column{{Name: "failures"}}}).Create(&failure).Error
+	return failure.Failures, err
+}
+
+// ReleaseLoginFailure takes back one failure counted for an attempt that
+// turned out to succeed.
+func (s *LoginFailureStoreGorm) ReleaseLoginFailure(key string) error {
+	return s.db.Model(&models.LoginFailure{}).
+		Where("key = ? AND failures > 0", key).
+		UpdateColumn("failures", gorm.Expr("failures - 1")).Error
+}
+
+func (s *LoginFailureStoreGorm) ClearLoginFailures(key string) error {
+	return s.db.Where("key = ?", key).Delete(&models.LoginFailure{}).Error
+}
+
+func (s *LoginFailureStoreGorm) PruneLoginFailures(before time.Time) error {
+	return s.db.Where("last_failed_at < ?", before).Delete(&models.LoginFailure{}).Error
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type NotificationStore interface {
+	CreateNotification(notification *models.Notification) error
+	GetNotifications(userID uint, unreadOnly bool, limit int) ([]models.Notification, error)
+	CountUnread(userID uint) (int64, error)
+	MarkRead(userID, id uint, readAt time.Time) (bool, error)
+	MarkAllRead(userID uint, readAt time.Time) error
+}
+
+type NotificationStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewNotificationStore(db *gorm.DB) NotificationStore {
+	return &NotificationStoreGorm{db: db}
+}
+
+func (s *NotificationStoreGorm) CreateNotification(notification *models.Notification) error {
+	return s.db.Create(notification).Error
+}
+
+func (s *NotificationStoreGorm) GetNotifications(userID uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	q := s.db.Where("user_id = ?", userID)
+	if unreadOnly {
+		q = q.Where("read_at IS NULL")
+	}
+	return notifications, q.Order("id DESC").Limit(limit).Find(&notifications).Error
+}
+
+func (s *NotificationStoreGorm) CountUnread(userID uint) (int64, error) {
+	var count int64
+	return count, s.db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+}
+
+// MarkRead reports whether a notification with the given id exists for the user.
+func (s *NotificationStoreGorm) MarkRead(userID, id uint, readAt time.Time) (bool, error) {
+	var notification models.Notification
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if notification.ReadAt != nil {
+		return true, nil
+	}
+
+	return true, s.db.Model(&notification).Update("read_at", readAt).Error
+}
+
+func (s *NotificationStoreGorm) MarkAllRead(userID uint, readAt time.Time) error {
+	return s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", readAt).Error
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthStore interface {
+	CreateClient(client *models.OAuthClient) error
+	GetClient(id uint) (*models.OAuthClient, error)
+	GetClientByClientID(clientID string) (*models.OAuthClient, error)
+	GetClients(userID uint) ([]models.OAuthClient, error)
+	DeleteClient(id uint) error
+	CreateAuthorizationCode(code *models.OAuthAuthorizationCode) error
+	GetAuthorizationCodeForUpdate(codeHash string) (*models.OAuthAuthorizationCode, error)
+	MarkAuthorizationCodeUsed(destination *models.OAuthAuthorizationCode, sessionID uint) error
+	PruneAuthorizationCodes(before time.Time) error
+}
+
+type OAuthStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewOAuthStore(db *gorm.DB) OAuthStore {
+	return &OAuthStoreGorm{db: db}
+}
+
+func (s *OAuthStoreGorm) CreateClient(client *models.OAuthClient) error {
+	return s.db.Create(client).Error
+}
+
+func (s *OAuthStoreGorm) GetClient(id uint) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	return &client, s.db.First(&client, id).Error
+}
+
+func (s *OAuthStoreGorm) GetClientByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	return &client, s.db.Where("client_id = ?", clientID).First(&client).Error
+}
+
+func (s *OAuthStoreGorm) GetClients(userID uint) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	return clients, s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&clients).Error
+}
+
+func (s *OAuthStoreGorm) DeleteClient(id uint) error {
+	return s.db.Delete(&models.OAuthClient{}, id).Error
+}
+
+func (s *OAuthStoreGorm) CreateAuthorizationCode(code *models.OAuthAuthorizationCode) error {
+	return s.db.Create(code).Error
+}
+
+func (s *OAuthStoreGorm) GetAuthorizationCodeForUpdate(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	return &code, s.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code_hash = ?", codeHash).
+		First(&code).Error
+}
+
+func (s *OAuthStoreGorm) MarkAuthorizationCodeUsed(destination *models.OAuthAuthorizationCode, sessionID uint) error {
+	return s.db.Model(destination).Updates(map[string]any{
+		"used_at":    time.Now(),
+		"session_id": sessionID,
+	}).Error
+}
+
+func (s *OAuthStoreGorm) PruneAuthorizationCodes(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.OAuthAuthorizationCode{}).Error
+}
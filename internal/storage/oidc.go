@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OIDCStore interface {
+	CreateLoginState(state *models.OIDCLoginState) error
+	TakeLoginState(stateHash string) (*models.OIDCLoginState, error)
+	PruneLoginStates(before time.Time) error
+	LockIdentity(issuer, subject string) error
+	GetIdentity(issuer, subject string) (*models.ExternalIdentity, error)
+	CreateIdentity(identity *models.ExternalIdentity) (*models.ExternalIdentity, bool, error)
+	TouchIdentity(identity *models.ExternalIdentity, email string) error
+}
+
+type OIDCStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewOIDCStore(db *gorm.DB) OIDCStore {
+	return &OIDCStoreGorm{db: db}
+}
+
+func (s *OIDCStoreGorm) CreateLoginState(state *models.OIDCLoginState) error {
+	return s.db.Create(state).Error
+}
+
+// TakeLoginState deletes the login state with stateHash and returns it, so
+// each state can complete one login only.
+func (s *OIDCStoreGorm) TakeLoginState(stateHash string) (*models.OIDCLoginState, error) {
+	var states []models.OIDCLoginState
+	err := s.db.
+		Clauses(clause.Returning{}).
+		Where("state_hash = ?", stateHash).
+		Delete(&states).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(states) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &states[0], nil
+}
+
+func (s *OIDCStoreGorm) PruneLoginStates(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.OIDCLoginState{}).Error
+}
+
+// identityLockClass namespaces the advisory locks taken by first logins.
+const identityLockClass = 0x6f696463
+
+// LockIdentity serializes logins of one identity for the rest of the
+// transaction, so that two first logins do not both provision a user.
+func (s *OIDCStoreGorm) LockIdentity(issuer, subject string) error {
+	return s.db.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", identityLockClass, issuer+" "+subject).Error
+}
+
+func (s *OIDCStoreGorm) GetIdentity(issuer, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	return &identity, s.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+}
+
+// CreateIdentity stores identity and reports true, or returns the identity
+// already stored for its issuer and subject and reports false.
+func (s *OIDCStoreGorm) CreateIdentity(identity *models.ExternalIdentity) (*models.ExternalIdentity, bool, error) {
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(identity)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return identity, true, nil
+	}
+
+	existing, err := s.GetIdentity(identity.Issuer, identity.Subject)
+	return existing, false, err
+}
+
+func (s *OIDCStoreGorm) TouchIdentity(identity *models.ExternalIdentity, email string) error {
+	return s.db.Model(identity).Updates(map[string]any{
+		"email":         email,
+		"last_login_at": time.Now(),
+	}).Error
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type OutboxStore interface {
+	EnqueueEmail(email *models.OutboxEmail) error
+	ClaimDueEmails(now time.Time, lease time.Duration, maxAttempts, limit int) ([]models.OutboxEmail, error)
+	MarkEmailSent(id uint, sentAt time.Time) error
+	MarkEmailFailed(id uint, lastError string, nextAttemptAt time.Time) error
+	PruneEmails(before time.Time, maxAttempts int) error
+}
+
+type OutboxStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewOutboxStore(db *gorm.DB) OutboxStore {
+	return &OutboxStoreGorm{db: db}
+}
+
+func (s *OutboxStoreGorm) EnqueueEmail(email *models.OutboxEmail) error {
+	return s.db.Create(email).Error
+}
+
+// ClaimDueEmails leases up to limit unsent emails by pushing their next
+// attempt past the lease, so concurrent workers skip them.
+func (s *OutboxStoreGorm) ClaimDueEmails(now time.Time, lease time.Duration, maxAttempts, limit int) ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+	err := s.db.Raw(`
+		UPDATE outbox_emails SET next_attempt_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox_emails
+			WHERE sent_at IS NULL AND next_attempt_at <= ? AND attempts < ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, maxAttempts, limit,
+	).Scan(&emails).Error
+	return emails, err
+}
+
+func (s *OutboxStoreGorm) MarkEmailSent(id uint, sentAt time.Time) error {
+	return s.db.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(map[string]any{
+		"sent_at":    sentAt,
+		"last_error": "",
+	}).Error
+}
+
+func (s *OutboxStoreGorm) MarkEmailFailed(id uint, lastError string, nextAttemptAt time.Time) error {
+	return s.db.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(map[string]any{
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
+
+// PruneEmails deletes emails sent before the given time, and emails that
+// gave up after maxAttempts with their last attempt before it. Their bodies
+// hold links with live tokens, so they are not kept around.
+func (s *OutboxStoreGorm) PruneEmails(before time.Time, maxAttempts int) error {
+	return s.db.
+		Where("sent_at < ?", before).
+		Or("sent_at IS NULL AND attempts >= ? AND updated_at < ?", maxAttempts, before).
+		Delete(&models.OutboxEmail{}).Error
+}
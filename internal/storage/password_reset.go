@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PasswordResetStore interface {
+	CreatePasswordResetToken(token *models.PasswordResetToken) error
+	GetPasswordResetTokenForUpdate(tokenHash string) (*models.PasswordResetToken, error)
+	InvalidatePasswordResetTokens(userID uint) error
+	PrunePasswordResetTokens(before time.Time) error
+}
+
+type PasswordResetStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetStore(db *gorm.DB) PasswordResetStore {
+	return &PasswordResetStoreGorm{db: db}
+}
+
+func (s *PasswordResetStoreGorm) CreatePasswordResetToken(token *models.PasswordResetToken) error {
+	return s.db.Create(token).Error
+}
+
+func (s *PasswordResetStoreGorm) GetPasswordResetTokenForUpdate(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	return &token, s.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+}
+
+// InvalidatePasswordResetTokens marks every unused reset token of the user
+// as used.
+func (s *PasswordResetStoreGorm) InvalidatePasswordResetTokens(userID uint) error {
+	return s.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+func (s *PasswordResetStoreGorm) PrunePasswordResetTokens(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.PasswordResetToken{}).Error
+}
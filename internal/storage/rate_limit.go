@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RateLimitStore interface {
+	GetBucketForUpdate(key string) (*models.RateLimitBucket, error)
+	SaveBucket(bucket *models.RateLimitBucket) error
+	PruneBuckets(before time.Time) error
+}
+
+type RateLimitStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewRateLimitStore(db *gorm.DB) RateLimitStore {
+	return &RateLimitStoreGorm{db: db}
+}
+
+func (s *RateLimitStoreGorm) GetBucketForUpdate(key string) (*models.RateLimitBucket, error) {
+	var bucket models.RateLimitBucket
+	return &bucket, s.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("key = ?", key).
+		First(&bucket).Error
+}
+
+// SaveBucket inserts or updates the bucket. Two requests creating the same
+// bucket at once both succeed, and the later one wins.
+func (s *RateLimitStoreGorm) SaveBucket(bucket *models.RateLimitBucket) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(bucket).Error
+}
+
+func (s *RateLimitStoreGorm) PruneBuckets(before time.Time) error {
+	return s.db.Where("full_at < ?", before).Delete(&models.RateLimitBucket{}).Error
+}
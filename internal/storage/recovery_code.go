@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeStore interface {
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	DeleteRecoveryCodes(userID uint) error
+}
+
+type RecoveryCodeStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeStore(db *gorm.DB) RecoveryCodeStore {
+	return &RecoveryCodeStoreGorm{db: db}
+}
+
+// ReplaceRecoveryCodes deletes the user's recovery codes and stores new
+// ones. It should run in a transaction.
+func (s *RecoveryCodeStoreGorm) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	if err := s.DeleteRecoveryCodes(userID); err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+
+	return s.db.Create(&codes).Error
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It
+// reports false if there is no such code.
+func (s *RecoveryCodeStoreGorm) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *RecoveryCodeStoreGorm) DeleteRecoveryCodes(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	GetRefreshTokenForUpdate(tokenHash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(token *models.RefreshToken, replacedByID uint) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeRefreshTokenFamilyOf(userID uint, tokenHash string) error
+	RevokeUserRefreshTokens(userID uint) error
+	PruneRefreshTokens(before time.Time) error
+}
+
+type RefreshTokenStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenStore(db *gorm.DB) RefreshTokenStore {
+	return &RefreshTokenStoreGorm{db: db}
+}
+
+func (s *RefreshTokenStoreGorm) CreateRefreshToken(token *models.RefreshToken) error {
+	return s.db.Create(token).Error
+}
+
+// GetRefreshTokenForUpdate loads a token by hash and locks it, so that two
+// concurrent uses of the same token cannot both succeed.
+func (s *RefreshTokenStoreGorm) GetRefreshTokenForUpdate(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	return &token, s.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+}
+
+func (s *RefreshTokenStoreGorm) MarkRefreshTokenUsed(token *models.RefreshToken, replacedByID uint) error {
+	return s.db.Model(token).Updates(map[string]any{
+		"used_at":        time.Now(),
+		"replaced_by_id": replacedByID,
+	}).Error
+}
+
+func (s *RefreshTokenStoreGorm) RevokeRefreshTokenFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeRefreshTokenFamilyOf revokes the family of the user's token with
+// tokenHash, if there is one.
+func (s *RefreshTokenStoreGorm) RevokeRefreshTokenFamilyOf(userID uint, tokenHash string) error {
+	family := s.db.Model(&models.RefreshToken{}).
+		Select("family_id").
+		Where("user_id = ? AND token_hash = ?", userID, tokenHash)
+
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id IN (?) AND revoked_at IS NULL", family).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *RefreshTokenStoreGorm) RevokeUserRefreshTokens(userID uint) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *RefreshTokenStoreGorm) PruneRefreshTokens(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.RefreshToken{}).Error
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type ReminderStore interface {
+	CreateReminder(reminder *models.Reminder) error
+	GetReminder(id uint) (*models.Reminder, error)
+	GetReminders(taskID uint) ([]models.Reminder, error)
+	DeleteReminder(id uint) error
+	RescheduleReminders(taskID uint, dueAt *time.Time) error
+	ClaimDueReminders(now time.Time, lease time.Duration, maxAttempts, limit int) ([]models.Reminder, error)
+	MarkReminderSent(reminder *models.Reminder, sentAt time.Time) (bool, error)
+	MarkReminderFailed(reminder *models.Reminder, lastError string, retryAt time.Time) error
+}
+
+type ReminderStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewReminderStore(db *gorm.DB) ReminderStore {
+	return &ReminderStoreGorm{db: db}
+}
+
+func (s *ReminderStoreGorm) CreateReminder(reminder *models.Reminder) error {
+	return s.db.Omit("Task").Create(reminder).Error
+}
+
+func (s *ReminderStoreGorm) GetReminder(id uint) (*models.Reminder, error) {
+	var reminder models.Reminder
+	return &reminder, s.db.First(&reminder, id).Error
+}
+
+func (s *ReminderStoreGorm) GetReminders(taskID uint) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	return reminders, s.db.Where("task_id = ?", taskID).Order("fire_at ASC NULLS LAST, id ASC").Find(&reminders).Error
+}
+
+func (s *ReminderStoreGorm) DeleteReminder(id uint) error {
+	return s.db.Delete(&models.Reminder{}, id).Error
+}
+
+// RescheduleReminders recomputes relative reminders of a task after its due
+// date changed. Rescheduled reminders fire again even if they were already
+// sent for the previous due date.
+func (s *ReminderStoreGorm) RescheduleReminders(taskID uint, dueAt *time.Time) error {
+	var reminders []models.Reminder
+	if err := s.db.Where("task_id = ? AND offset_minutes IS NOT NULL", taskID).Find(&reminders).Error; err != nil {
+		return err
+	}
+
+	for _, reminder := range reminders {
+		reminder.ResolveFireAt(dueAt)
+		err := s.db.Model(&reminder).Updates(map[string]any{
+			"fire_at":      reminder.FireAt,
+			"sent_at":      nil,
+			"attempts":     0,
+			"locked_until": nil,
+			"last_error":   "",
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimDueReminders leases up to limit unsent reminders whose fire time has
+// passed. FOR UPDATE SKIP LOCKED together with the lease keeps concurrent
+// server instances from claiming the same reminder.
+func (s *ReminderStoreGorm) ClaimDueReminders(now time.Time, lease time.Duration, maxAttempts, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := s.db.Raw(`
+		UPDATE reminders SET locked_until = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT r.id FROM reminders r
+			JOIN tasks t ON t.id = r.task_id
+			WHERE r.sent_at IS NULL
+				AND r.fire_at <= ?
+				AND (r.locked_until IS NULL OR r.locked_until < ?)
+				AND r.attempts < ?
+				AND t.completed = false
+			ORDER BY r.fire_at
+			LIMIT ?
+			FOR UPDATE OF r SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, now, maxAttempts, limit,
+	).Scan(&reminders).Error
+	return reminders, err
+}
+
+// MarkReminderSent marks a claimed reminder sent. It reports false if the
+// claim was lost, because the lease ran out and another instance claimed
+// the reminder, or because the reminder was rescheduled since.
+func (s *ReminderStoreGorm) MarkReminderSent(reminder *models.Reminder, sentAt time.Time) (bool, error) {
+	res := s.db.Model(&models.Reminder{}).
+		Where("id = ? AND sent_at IS NULL AND locked_until = ?", reminder.ID, reminder.LockedUntil).
+		Updates(map[string]any{
+			"sent_at":      sentAt,
+			"locked_until": nil,
+			"last_error":   "",
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// MarkReminderFailed schedules a claimed reminder for another attempt,
+// unless the claim was lost.
+func (s *ReminderStoreGorm) MarkReminderFailed(reminder *models.Reminder, lastError string, retryAt time.Time) error {
+	return s.db.Model(&models.Reminder{}).
+		Where("id = ? AND sent_at IS NULL AND locked_until = ?", reminder.ID, reminder.LockedUntil).
+		Updates(map[string]any{
+			"locked_until": retryAt,
+			"last_error":   lastError,
+		}).Error
+}
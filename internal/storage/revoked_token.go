@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevokedTokenStore interface {
+	RevokeToken(token *models.RevokedToken) error
+	GetRevokedTokensSince(since time.Time, afterID uint, limit int) ([]models.RevokedToken, error)
+	PruneRevokedTokens(before time.Time) error
+}
+
+type RevokedTokenStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewRevokedTokenStore(db *gorm.DB) RevokedTokenStore {
+	return &RevokedTokenStoreGorm{db: db}
+}
+
+func (s *RevokedTokenStoreGorm) RevokeToken(token *models.RevokedToken) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// GetRevokedTokensSince returns revocations created after since, or at
+// since with an id above afterID, in order of creation.
+func (s *RevokedTokenStoreGorm) GetRevokedTokensSince(since time.Time, afterID uint, limit int) ([]models.RevokedToken, error) {
+	var tokens []models.RevokedToken
+	return tokens, s.db.
+		Where("(created_at, id) > (?, ?)", since, afterID).
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Find(&tokens).Error
+}
+
+func (s *RevokedTokenStoreGorm) PruneRevokedTokens(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.RevokedToken{}).Error
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type SessionStore interface {
+	CreateSession(session *models.Session) error
+	GetSession(id uint) (*models.Session, error)
+	GetSessionByFamily(familyID string) (*models.Session, error)
+	GetActiveSessions(userID uint, seenSince time.Time) ([]models.Session, error)
+	GetClientSessions(clientID string) ([]models.Session, error)
+	TouchSession(destination *models.Session, ip, userAgent string) error
+	RevokeSession(destination *models.Session) error
+	RevokeUserSessions(userID uint) error
+	PruneSessions(seenBefore time.Time) error
+}
+
+type SessionStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewSessionStore(db *gorm.DB) SessionStore {
+	return &SessionStoreGorm{db: db}
+}
+
+func (s *SessionStoreGorm) CreateSession(session *models.Session) error {
+	return s.db.Create(session).Error
+}
+
+func (s *SessionStoreGorm) GetSession(id uint) (*models.Session, error) {
+	var session models.Session
+	return &session, s.db.First(&session, id).Error
+}
+
+func (s *SessionStoreGorm) GetSessionByFamily(familyID string) (*models.Session, error) {
+	var session models.Session
+	return &session, s.db.Where("refresh_family_id = ?", familyID).First(&session).Error
+}
+
+func (s *SessionStoreGorm) GetActiveSessions(userID uint, seenSince time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	return sessions, s.db.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at >= ?", userID, seenSince).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+}
+
+// GetClientSessions returns the unrevoked sessions started by an OAuth
+// client.
+func (s *SessionStoreGorm) GetClientSessions(clientID string) ([]models.Session, error) {
+	var sessions []models.Session
+	return sessions, s.db.Where("client_id = ? AND revoked_at IS NULL", clientID).Find(&sessions).Error
+}
+
+func (s *SessionStoreGorm) TouchSession(destination *models.Session, ip, userAgent string) error {
+	return s.db.Model(destination).Updates(map[string]any{
+		"last_seen_at": time.Now(),
+		"ip":           ip,
+		"user_agent":   userAgent,
+	}).Error
+}
+
+func (s *SessionStoreGorm) RevokeSession(destination *models.Session) error {
+	return s.db.Model(destination).Update("revoked_at", time.Now()).Error
+}
+
+func (s *SessionStoreGorm) RevokeUserSessions(userID uint) error {
+	return s.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// PruneSessions deletes revoked sessions and those idle since seenBefore.
+func (s *SessionStoreGorm) PruneSessions(seenBefore time.Time) error {
+	return s.db.Where("revoked_at IS NOT NULL OR last_seen_at < ?", seenBefore).Delete(&models.Session{}).Error
+}
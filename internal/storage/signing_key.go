@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type SigningKeyStore interface {
+	CreateSigningKey(key *models.SigningKey) error
+	GetSigningKeys(now time.Time) ([]models.SigningKey, error)
+	RetireSigningKeys(exceptID uint, expiresAt time.Time) error
+	PruneSigningKeys(before time.Time) error
+}
+
+type SigningKeyStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyStore(db *gorm.DB) SigningKeyStore {
+	return &SigningKeyStoreGorm{db: db}
+}
+
+func (s *SigningKeyStoreGorm) CreateSigningKey(key *models.SigningKey) error {
+	return s.db.Create(key).Error
+}
+
+// GetSigningKeys returns the keys that have not expired at now, newest
+// first.
+func (s *SigningKeyStoreGorm) GetSigningKeys(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	return keys, s.db.
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("id DESC").
+		Find(&keys).Error
+}
+
+// RetireSigningKeys sets the expiry of every current key other than
+// exceptID.
+func (s *SigningKeyStoreGorm) RetireSigningKeys(exceptID uint, expiresAt time.Time) error {
+	return s.db.Model(&models.SigningKey{}).
+		Where("id <> ? AND expires_at IS NULL", exceptID).
+		Update("expires_at", expiresAt).Error
+}
+
+func (s *SigningKeyStoreGorm) PruneSigningKeys(before time.Time) error {
+	return s.db.Where("expires_at < ?", before).Delete(&models.SigningKey{}).Error
+}
@@ -3,13 +3,59 @@ package storage
 import "gorm.io/gorm"
 
 type Storage struct {
-	Users UserStore
-	Tasks TaskStore
+	db            *gorm.DB
+	Users         UserStore
+	Tasks         TaskStore
+	Templates     TemplateStore
+	Reminders     ReminderStore
+	Notifications NotificationStore
+	Outbox        OutboxStore
+	Webhooks      WebhookStore
+	Events        EventStore
+	Idempotency   IdempotencyStore
+	RefreshTokens RefreshTokenStore
+	RevokedTokens RevokedTokenStore
+	Sessions      SessionStore
+	PasswordReset PasswordResetStore
+	RecoveryCodes RecoveryCodeStore
+	AccessTokens  AccessTokenStore
+	SigningKeys   SigningKeyStore
+	OAuth         OAuthStore
+	OIDC          OIDCStore
+	LoginFailures LoginFailureStore
+	RateLimits    RateLimitStore
 }
 
 func NewStorage(db *gorm.DB) *Storage {
 	return &Storage{
-		Users: NewUserStore(db),
-		Tasks: NewTaskStore(db),
+		db:            db,
+		Users:         NewUserStore(db),
+		Tasks:         NewTaskStore(db),
+		Templates:     NewTemplateStore(db),
+		Reminders:     NewReminderStore(db),
+		Notifications: NewNotificationStore(db),
+		Outbox:        NewOutboxStore(db),
+		Webhooks:      NewWebhookStore(db),
+		Events:        NewEventStore(db),
+		Idempotency:   NewIdempotencyStore(db),
+		RefreshTokens: NewRefreshTokenStore(db),
+		RevokedTokens: NewRevokedTokenStore(db),
+		Sessions:      NewSessionStore(db),
+		PasswordReset: NewPasswordResetStore(db),
+		RecoveryCodes: NewRecoveryCodeStore(db),
+		AccessTokens:  NewAccessTokenStore(db),
+		SigningKeys:   NewSigningKeyStore(db),
+		OAuth:         NewOAuthStore(db),
+		OIDC:          NewOIDCStore(db),
+		LoginFailures: NewLoginFailureStore(db),
+		RateLimits:    NewRateLimitStore(db),
 	}
 }
+
+// Transaction runs fn with a Storage bound to a single database transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+func (s *Storage) Transaction(fn func(tx *Storage) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewStorage(tx))
+	})
+}
@@ -1,16 +1,42 @@
 package storage
 
 import (
+	"errors"
+	"time"
+
 	"github.com/k1ender/task-master-go/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TaskStore interface {
 	CreateTask(task *models.Task) (*models.Task, error)
 	GetTask(id uint) (*models.Task, error)
 	GetTasks(userID uint) ([]models.Task, error)
+	GetTaskForUpdate(id uint) (*models.Task, error)
 	UpdateTask(destination *models.Task, updates map[string]any) error
-	DeleteTask(id uint) error
+	DeleteTask(task *models.Task) error
+	GetDueTasks(userID uint, from, to time.Time) ([]models.Task, error)
+	GetOverdueTasks(userID uint, before time.Time) ([]models.Task, error)
+	GetCompletedTasks(userID uint, from, to time.Time) ([]models.Task, error)
+	GetTasksChangedSince(userID uint, afterVersion uint64, limit int) ([]models.Task, error)
+	GetTombstonesSince(userID uint, afterVersion uint64, limit int) ([]models.TaskTombstone, error)
+	GetTags(userID uint) ([]string, error)
+}
+
+// ErrVersionConflict is returned when a task changed between being read and
+// being written.
+var ErrVersionConflict = errors.New("task was modified concurrently")
+
+// syncLockClass namespaces the advisory locks taken by task writes.
+const syncLockClass = 0x7461736b
+
+// lockSync serializes task writes per user for the rest of the transaction.
+// Sync versions come from a shared sequence, so without the lock a write
+// could commit after a later-numbered one and be skipped by a client that
+// already synced past it.
+func lockSync(tx *gorm.DB, userID uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", syncLockClass, userID).Error
 }
 
 type TaskStoreGorm struct {
@@ -22,7 +48,13 @@ func NewTaskStore(db *gorm.DB) TaskStore {
 }
 
 func (s *TaskStoreGorm) CreateTask(task *models.Task) (*models.Task, error) {
-	return task, s.db.Create(task).Error
+	return task, s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSync(tx, task.UserID); err != nil {
+			return err
+		}
+
+		return tx.Create(task).Error
+	})
 }
 
 func (s *TaskStoreGorm) GetTask(id uint) (*models.Task, error) {
@@ -35,10 +67,124 @@ func (s *TaskStoreGorm) GetTasks(userID uint) ([]models.Task, error) {
 	return tasks, s.db.Where("user_id = ?", userID).Order("id DESC").Find(&tasks).Error
 }
 
+// GetTaskForUpdate loads a task and locks its row until the surrounding
+// transaction ends.
+func (s *TaskStoreGorm) GetTaskForUpdate(id uint) (*models.Task, error) {
+	var task models.Task
+	return &task, s.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, id).Error
+}
+
+// UpdateTask applies updates if destination still has the version it was
+// read at, and bumps the version. Otherwise it returns ErrVersionConflict.
 func (s *TaskStoreGorm) UpdateTask(destination *models.Task, updates map[string]any) error {
-	return s.db.Model(destination).Updates(updates).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSync(tx, destination.UserID); err != nil {
+			return err
+		}
+
+		var version uint64
+		if err := tx.Raw("SELECT nextval(?)", models.TaskSyncSequence).Scan(&version).Error; err != nil {
+			return err
+		}
+
+		values := make(map[string]any, len(updates)+2)
+		for k, v := range updates {
+			values[k] = v
+		}
+		values["sync_version"] = version
+		values["version"] = destination.Version + 1
+
+		res := tx.Model(destination).Where("version = ?", destination.Version).Updates(values)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		return nil
+	})
+}
+
+// DeleteTask deletes task with its subtasks and leaves a tombstone for each
+// of them. Like UpdateTask it fails with ErrVersionConflict if task is stale.
+func (s *TaskStoreGorm) DeleteTask(task *models.Task) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSync(tx, task.UserID); err != nil {
+			return err
+		}
+
+		err := tx.Exec(`
+			INSERT INTO task_tombstones (task_id, user_id, deleted_at)
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM tasks WHERE id = ?
+				UNION ALL
+				SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id
+			)
+			SELECT id, ?, ? FROM subtree`, task.ID, task.UserID, time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		res := tx.Where("version = ?", task.Version).Delete(&models.Task{}, task.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		return nil
+	})
+}
+
+func (s *TaskStoreGorm) GetDueTasks(userID uint, from, to time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	return tasks, s.db.
+		Where("user_id = ? AND completed = false AND due_at >= ? AND due_at < ?", userID, from, to).
+		Order("due_at ASC").
+		Find(&tasks).Error
+}
+
+func (s *TaskStoreGorm) GetOverdueTasks(userID uint, before time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	return tasks, s.db.
+		Where("user_id = ? AND completed = false AND due_at < ?", userID, before).
+		Order("due_at ASC").
+		Find(&tasks).Error
+}
+
+func (s *TaskStoreGorm) GetCompletedTasks(userID uint, from, to time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	return tasks, s.db.
+		Where("user_id = ? AND completed = true AND completed_at >= ? AND completed_at < ?", userID, from, to).
+		Order("completed_at ASC").
+		Find(&tasks).Error
+}
+
+func (s *TaskStoreGorm) GetTasksChangedSince(userID uint, afterVersion uint64, limit int) ([]models.Task, error) {
+	var tasks []models.Task
+	return tasks, s.db.
+		Where("user_id = ? AND sync_version > ?", userID, afterVersion).
+		Order("sync_version ASC").
+		Limit(limit).
+		Find(&tasks).Error
+}
+
+func (s *TaskStoreGorm) GetTombstonesSince(userID uint, afterVersion uint64, limit int) ([]models.TaskTombstone, error) {
+	var tombstones []models.TaskTombstone
+	return tombstones, s.db.
+		Where("user_id = ? AND sync_version > ?", userID, afterVersion).
+		Order("sync_version ASC").
+		Limit(limit).
+		Find(&tombstones).Error
 }
 
-func (s *TaskStoreGorm) DeleteTask(id uint) error {
-	return s.db.Delete(&models.Task{}, id).Error
+// GetTags returns the distinct tags used on the user's tasks.
+func (s *TaskStoreGorm) GetTags(userID uint) ([]string, error) {
+	tags := []string{}
+	return tags, s.db.
+		Raw(`SELECT DISTINCT tag FROM tasks, json_array_elements_text(tasks.tags::json) AS tag
+			WHERE tasks.user_id = ? AND tasks.tags <> '' ORDER BY tag`, userID).
+		Scan(&tags).Error
 }
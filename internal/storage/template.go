@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type TemplateStore interface {
+	CreateTemplate(template *models.TaskTemplate) error
+	GetTemplates(userID uint) ([]models.TaskTemplate, error)
+	DeleteTemplate(id uint) error
+}
+
+type TemplateStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewTemplateStore(db *gorm.DB) TemplateStore {
+	return &TemplateStoreGorm{db: db}
+}
+
+func (s *TemplateStoreGorm) CreateTemplate(template *models.TaskTemplate) error {
+	return s.db.Create(template).Error
+}
+
+func (s *TemplateStoreGorm) GetTemplates(userID uint) ([]models.TaskTemplate, error) {
+	var templates []models.TaskTemplate
+	return templates, s.db.
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&templates).Error
+}
+
+func (s *TemplateStoreGorm) DeleteTemplate(id uint) error {
+	return s.db.Delete(&models.TaskTemplate{}, id).Error
+}
@@ -1,14 +1,23 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/k1ender/task-master-go/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserStore interface {
 	CreateUser(user *models.User) error
 	GetUserByUsername(username string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
 	GetUser(id uint) (*models.User, error)
+	UpdateUser(destination *models.User, updates map[string]any) error
+	GetDigestSubscribers() ([]models.User, error)
+	ClaimDigest(userID uint, scheduledAt, now time.Time) (bool, error)
+	BumpTokenGeneration(destination *models.User) error
+	ClaimTOTPCounter(userID uint, counter int64) (bool, error)
 }
 
 type UserStoreGorm struct {
@@ -32,3 +41,43 @@ func (s *UserStoreGorm) GetUserByUsername(username string) (*models.User, error)
 	var user models.User
 	return &user, s.db.Where("username = ?", username).First(&user).Error
 }
+
+func (s *UserStoreGorm) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	return &user, s.db.Where("email = ?", email).First(&user).Error
+}
+
+func (s *UserStoreGorm) UpdateUser(destination *models.User, updates map[string]any) error {
+	return s.db.Model(destination).Updates(updates).Error
+}
+
+func (s *UserStoreGorm) GetDigestSubscribers() ([]models.User, error) {
+	var users []models.User
+	return users, s.db.Where("digest_frequency <> ?", models.DigestOff).Find(&users).Error
+}
+
+// ClaimDigest records that the digest scheduled at scheduledAt is being sent.
+// It reports false if it was already claimed, possibly by another instance.
+func (s *UserStoreGorm) ClaimDigest(userID uint, scheduledAt, now time.Time) (bool, error) {
+	res := s.db.Model(&models.User{}).
+		Where("id = ? AND (digest_last_sent_at IS NULL OR digest_last_sent_at < ?)", userID, scheduledAt).
+		Update("digest_last_sent_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// BumpTokenGeneration invalidates every access token issued to the user so
+// far and stores the new generation in destination.
+func (s *UserStoreGorm) BumpTokenGeneration(destination *models.User) error {
+	return s.db.Model(destination).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "token_generation"}}}).
+		UpdateColumn("token_generation", gorm.Expr("token_generation + 1")).Error
+}
+
+// ClaimTOTPCounter records that the TOTP code for counter was used. It
+// reports false if that or a later code was used before.
+func (s *UserStoreGorm) ClaimTOTPCounter(userID uint, counter int64) (bool, error) {
+	res := s.db.Model(&models.User{}).
+		Where("id = ? AND totp_counter < ?", userID, counter).
+		Update("totp_counter", counter)
+	return res.RowsAffected == 1, res.Error
+}
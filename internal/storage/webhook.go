@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"gorm.io/gorm"
+)
+
+type WebhookStore interface {
+	CreateWebhook(webhook *models.Webhook) error
+	GetWebhooks(userID uint) ([]models.Webhook, error)
+	UpdateWebhook(destination *models.Webhook, updates map[string]any) error
+	DeleteWebhook(id uint) error
+	EnqueueEvent(userID uint, event string, payload string, now time.Time) error
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	GetDelivery(id uint) (*models.WebhookDelivery, error)
+	GetDeliveries(webhookID uint, limit int) ([]models.WebhookDelivery, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	MarkDeliverySucceeded(delivery *models.WebhookDelivery, responseStatus int, now time.Time) error
+	MarkDeliveryFailed(delivery *models.WebhookDelivery, responseStatus int, lastError string, nextAttemptAt *time.Time, disableAfter int, now time.Time) error
+	PruneDeliveries(before time.Time) error
+}
+
+type WebhookStoreGorm struct {
+	db *gorm.DB
+}
+
+func NewWebhookStore(db *gorm.DB) WebhookStore {
+	return &WebhookStoreGorm{db: db}
+}
+
+func (s *WebhookStoreGorm) CreateWebhook(webhook *models.Webhook) error {
+	return s.db.Create(webhook).Error
+}
+
+func (s *WebhookStoreGorm) GetWebhooks(userID uint) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	return webhooks, s.db.Where("user_id = ?", userID).Order("id DESC").Find(&webhooks).Error
+}
+
+func (s *WebhookStoreGorm) UpdateWebhook(destination *models.Webhook, updates map[string]any) error {
+	return s.db.Model(destination).Updates(updates).Error
+}
+
+func (s *WebhookStoreGorm) DeleteWebhook(id uint) error {
+	return s.db.Delete(&models.Webhook{}, id).Error
+}
+
+// EnqueueEvent queues a delivery of payload to every active webhook of the
+// user that subscribes to event.
+func (s *WebhookStoreGorm) EnqueueEvent(userID uint, event string, payload string, now time.Time) error {
+	var webhooks []models.Webhook
+	if err := s.db.Where("user_id = ? AND active = true", userID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+
+		err := s.CreateDelivery(&models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *WebhookStoreGorm) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return s.db.Omit("Webhook").Create(delivery).Error
+}
+
+func (s *WebhookStoreGorm) GetDelivery(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	return &delivery, s.db.First(&delivery, id).Error
+}
+
+func (s *WebhookStoreGorm) GetDeliveries(webhookID uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	return deliveries, s.db.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+}
+
+// ClaimDueDeliveries leases up to limit pending deliveries of active
+// webhooks and loads their webhook.
+func (s *WebhookStoreGorm) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var ids []uint
+	err := s.db.Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active = true
+			ORDER BY d.next_attempt_at
+			LIMIT ?
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING id`,
+		now.Add(lease), models.DeliveryPending, now, limit,
+	).Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	return deliveries, s.db.Preload("Webhook").Where("id IN ?", ids).Order("id").Find(&deliveries).Error
+}
+
+func (s *WebhookStoreGorm) MarkDeliverySucceeded(delivery *models.WebhookDelivery, responseStatus int, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]any{
+			"status":          models.DeliverySucceeded,
+			"response_status": responseStatus,
+			"last_error":      "",
+			"delivered_at":    now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Webhook{}).Where("id = ?", delivery.WebhookID).Update("consecutive_failures", 0).Error
+	})
+}
+
+// MarkDeliveryFailed records a failed attempt. A nil nextAttemptAt gives up
+// on the delivery. The webhook is disabled once it has failed disableAfter
+// times in a row.
+func (s *WebhookStoreGorm) MarkDeliveryFailed(delivery *models.WebhookDelivery, responseStatus int, lastError string, nextAttemptAt *time.Time, disableAfter int, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]any{
+			"response_status": responseStatus,
+			"last_error":      lastError,
+		}
+		if nextAttemptAt != nil {
+			updates["next_attempt_at"] = *nextAttemptAt
+		} else {
+			updates["status"] = models.DeliveryFailed
+		}
+
+		if err := tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.Webhook{}).Where("id = ?", delivery.WebhookID).
+			Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Webhook{}).
+			Where("id = ? AND active = true AND consecutive_failures >= ?", delivery.WebhookID, disableAfter).
+			Updates(map[string]any{"active": false, "disabled_at": now}).Error
+	})
+}
+
+// PruneDeliveries deletes finished deliveries created before before.
+// Pending ones are kept until they succeed or are given up on.
+func (s *WebhookStoreGorm) PruneDeliveries(before time.Time) error {
+	return s.db.
+		Where("status <> ? AND created_at < ?", models.DeliveryPending, before).
+		Delete(&models.WebhookDelivery{}).Error
+}
@@ -0,0 +1,13 @@
+package utils
+
+import "time"
+
+// Backoff returns the delay before retry number attempt (starting at 1),
+// doubling from base and capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
@@ -1,35 +1,120 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const (
-	TokenExpirationTime = 24 * time.Hour
-)
-
 type AuthClaims struct {
 	UserID uint `json:"user_id"`
+	// Generation is the user's token generation at signing time. Bumping
+	// the generation invalidates every token signed before.
+	Generation uint `json:"gen"`
+	// SessionID is the login session the token was issued for.
+	SessionID uint `json:"sid,omitempty"`
+	// Scopes limit what the token can be used for. Tokens without scopes
+	// can do anything the user can.
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientID is the OAuth client the token was issued to.
+	ClientID string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func SignToken(userID uint, secret string) (string, error) {
-	claims := AuthClaims{
+// TokenKeys signs and verifies access tokens.
+type TokenKeys interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (any, error)
+	// Algorithms returns the algorithms accepted when verifying.
+	Algorithms() []string
+}
+
+// SignToken signs an access token with claims that expires after ttl. The
+// registered claims, including a random jti, are filled in.
+func SignToken(claims AuthClaims, ttl time.Duration, keys TokenKeys) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "task-master-go",
+		Subject:   "user",
+	}
+
+	return keys.Sign(claims)
+}
+
+// ParseToken validates an access token produced by SignToken.
+func ParseToken(token string, keys TokenKeys) (*AuthClaims, error) {
+	var claims AuthClaims
+	_, err := jwt.ParseWithClaims(token, &claims, keys.Keyfunc, jwt.WithValidMethods(keys.Algorithms()), jwt.WithSubject("user"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+type ActionClaims struct {
+	UserID uint   `json:"user_id"`
+	Action string `json:"action"`
+	jwt.RegisteredClaims
+}
+
+// SignActionToken signs a token that authorises a single kind of action,
+// such as following an unsubscribe link, for userID. A zero ttl produces a
+// token that does not expire.
+func SignActionToken(userID uint, action string, ttl time.Duration, secret string) (string, error) {
+	claims := ActionClaims{
 		UserID: userID,
+		Action: action,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExpirationTime)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "task-master-go",
-			Subject:   "user",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Issuer:   "task-master-go",
+			Subject:  "action",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if ttl > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	}
 
-	ss, err := token.SignedString([]byte(secret))
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// ParseActionToken validates a token produced by SignActionToken for action
+// and returns the user it was issued for.
+func ParseActionToken(token, action, secret string) (uint, error) {
+	claims, err := ParseActionClaims(token, secret)
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.Action != action {
+		return 0, errors.New("token was issued for a different action")
+	}
+
+	return claims.UserID, nil
+}
+
+// ParseActionClaims validates a token produced by SignActionToken for any
+// action. It is for actions that depend on the user, which the caller must
+// load before checking the action.
+func ParseActionClaims(token, secret string) (*ActionClaims, error) {
+	var claims ActionClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithSubject("action"))
+	if err != nil {
+		return nil, err
+	}
 
-	return ss, err
+	return &claims, nil
 }
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// ExpandPlaceholders replaces every {{name}} in s with vars[name].
+// It fails if s references a variable that is not present in vars.
+func ExpandPlaceholders(s string, vars map[string]string) (string, error) {
+	missing := map[string]bool{}
+	out := placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholderPattern.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return m
+		}
+		return v
+	})
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("missing variables: %s", strings.Join(names, ", "))
+	}
+
+	return out, nil
+}
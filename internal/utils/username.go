@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Usernames are 3 to 32 letters, digits, dots, underscores and hyphens.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+)
+
+// ValidUsername reports whether s may be registered as a username.
+func ValidUsername(s string) bool {
+	n := utf8.RuneCountInString(s)
+	if n < MinUsernameLength || n > MaxUsernameLength {
+		return false
+	}
+
+	return strings.IndexFunc(s, func(r rune) bool { return !usernameRune(r) }) < 0
+}
+
+// ValidateUsername is the "username" validation tag.
+func ValidateUsername(fl validator.FieldLevel) bool {
+	return ValidUsername(fl.Field().String())
+}
+
+// SanitizeUsername turns s into a valid username of at most maxLength
+// runes by replacing the characters usernames cannot have with
+// underscores, trimmed from the ends. It returns "" if too little of s is
+// left.
+func SanitizeUsername(s string, maxLength int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.TrimSpace(s) {
+		if n == maxLength {
+			break
+		}
+		if !usernameRune(r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+		n++
+	}
+
+	username := strings.Trim(b.String(), "_")
+	if !ValidUsername(username) {
+		return ""
+	}
+	return username
+}
+
+func usernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-'
+}
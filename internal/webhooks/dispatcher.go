@@ -0,0 +1,157 @@
+// Package webhooks delivers task events to user-registered HTTP endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/k1ender/task-master-go/internal/models"
+	"github.com/k1ender/task-master-go/internal/storage"
+	"github.com/k1ender/task-master-go/internal/utils"
+)
+
+const (
+	lease          = 2 * time.Minute
+	maxAttempts    = 8
+	batchSize      = 50
+	baseBackoff    = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+	requestTimeout = 10 * time.Second
+
+	// DisableAfter is the number of consecutive failed attempts after which
+	// a webhook is disabled.
+	DisableAfter = 15
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+	// Changes maps the columns modified by an update to their new values.
+	Changes map[string]any `json:"changes,omitempty"`
+}
+
+// NewPayload encodes the body sent to webhooks for event.
+func NewPayload(event string, data any, changes map[string]any) (string, error) {
+	b, err := json.Marshal(Payload{Event: event, CreatedAt: time.Now().UTC(), Data: data, Changes: changes})
+	return string(b), err
+}
+
+// Sign returns the X-Webhook-Signature header value for body. Receivers
+// recompute the HMAC-SHA256 of "<t>.<body>" with their secret, compare it
+// with v1 and reject stale timestamps.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+type Dispatcher struct {
+	store  *storage.Storage
+	client *http.Client
+	log    *slog.Logger
+}
+
+func NewDispatcher(store *storage.Storage, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: NewClient(),
+		log:    logger,
+	}
+}
+
+// Run delivers all pending webhook deliveries that are due.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		deliveries, err := d.store.Webhooks.ClaimDueDeliveries(time.Now(), lease, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			status, err := d.deliver(ctx, &delivery)
+			now := time.Now()
+
+			if err == nil {
+				if err := d.store.Webhooks.MarkDeliverySucceeded(&delivery, status, now); err != nil {
+					return err
+				}
+				continue
+			}
+
+			d.log.Warn("webhook delivery failed",
+				slog.Uint64("delivery_id", uint64(delivery.ID)),
+				slog.Int("attempt", delivery.Attempts),
+				slog.Any("error", err),
+			)
+
+			var next *time.Time
+			if delivery.Attempts < maxAttempts {
+				at := now.Add(utils.Backoff(delivery.Attempts, baseBackoff, maxBackoff))
+				next = &at
+			}
+
+			if err := d.store.Webhooks.MarkDeliveryFailed(&delivery, status, err.Error(), next, DisableAfter, now); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-master-go-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, time.Now(), body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// The body is never recorded: last_error is shown to the webhook's
+	// owner, and must not reveal what the endpoint answered.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}